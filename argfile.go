@@ -0,0 +1,345 @@
+package struct_flags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var argFilesExpandedKey = contextKey{value: 12}
+
+// pathOption is the flag option of a field with a path, see resolveArgFilePaths
+const pathOption = "path"
+
+// expandArgFiles replaces each @argfile after the command path with the command and args of the file, in place.
+// An argument starting with '@@' is passed on with a single '@', and the arguments after '--' are not expanded.
+func expandArgFiles(ctx context.Context, args []string) (context.Context, []string, error) {
+	if expanded, _ := ctx.Value(argFilesExpandedKey).(bool); expanded {
+		return ctx, args, nil
+	}
+	ctx = context.WithValue(ctx, argFilesExpandedKey, true)
+	start := len(getParentCommands(ctx)) + 1
+	if len(args) <= start {
+		return ctx, args, nil
+	}
+	sources := tailSources(getArgSources(ctx), len(args)-start)
+	var expandedArgs []string
+	var expandedSources []Source
+	changed := false
+	for i := start; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			expandedArgs = append(expandedArgs, args[i:]...)
+			expandedSources = append(expandedSources, sources[i-start:]...)
+			break
+		}
+		switch {
+		case strings.HasPrefix(arg, "@@"):
+			expandedArgs = append(expandedArgs, arg[1:])
+			expandedSources = append(expandedSources, sources[i-start])
+			changed = true
+		case len(arg) > 1 && arg[0] == '@':
+			fileArgs, fileSources, fileCtx, err := argFileArgs(ctx, arg[1:])
+			if err != nil {
+				return ctx, args, err
+			}
+			ctx = fileCtx
+			expandedArgs = append(expandedArgs, fileArgs...)
+			expandedSources = append(expandedSources, fileSources...)
+			changed = true
+		default:
+			expandedArgs = append(expandedArgs, arg)
+			expandedSources = append(expandedSources, sources[i-start])
+		}
+	}
+	if !changed {
+		return ctx, args, nil
+	}
+	return withArgSources(ctx, expandedSources), append(append([]string{}, args[:start]...), expandedArgs...), nil
+}
+
+// argFileArgs reads an @argfile, adds its environment to the context and returns its command and args, with their sources.
+// The environment is read by the flags of the command and $var in the args, see Environ.
+func argFileArgs(ctx context.Context, filename string) ([]string, []Source, context.Context, error) {
+	argFile, err := loadArgFile(filename, nil)
+	if err != nil {
+		return nil, nil, ctx, err
+	}
+	ctx = withArgFile(ctx, &argFile)
+	applied, fileSources, err := argFile.withProfile(getProfile(ctx), filename)
+	if err != nil {
+		return nil, nil, ctx, err
+	}
+	env := getEnvLayer(ctx)
+	for _, kv := range applied.Env {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, nil, ctx, fmt.Errorf("invalid env \"%s\" in @argfile %s, expected NAME=value", kv, filename)
+		}
+		name, value := kv[:i], env.expand(kv[i+1:])
+		env = env.with(name, value)
+		if getOptions(ctx).ExportArgFileEnv {
+			if err := os.Setenv(name, value); err != nil {
+				return nil, nil, ctx, fmt.Errorf("failed to apply environment variable %s from @argfile", err.Error())
+			}
+		}
+	}
+	ctx = withEnvLayer(ctx, env)
+	args := append([]string{}, applied.Command...)
+	var sources []Source
+	for i := range applied.Command {
+		sources = append(sources, Source{Kind: FromArgFile, Name: filename, Key: "command", Position: i})
+	}
+	for _, arg := range applied.Args {
+		args = append(args, env.expand(arg))
+	}
+	return args, append(sources, fileSources...), ctx, nil
+}
+
+// readArgFile reads an ArgFile from a .json, .yaml, .yml or .toml file. A file with another extension is a JSON object,
+// or a response file with the arguments, see splitResponseFile.
+func readArgFile(filename string) (ArgFile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ArgFile{}, fmt.Errorf("could not open @argfile, err: %s", err.Error())
+	}
+	var argFile ArgFile
+	switch ext := strings.ToLower(filepath.Ext(filename)); {
+	case ext == ".yaml" || ext == ".yml":
+		err = yaml.Unmarshal(data, &argFile)
+	case ext == ".toml":
+		_, err = toml.Decode(string(data), &argFile)
+	case ext == ".json" || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		err = unmarshalJSON(data, &argFile)
+	default:
+		argFile.Args, err = splitResponseFile(string(data))
+	}
+	if err != nil {
+		return ArgFile{}, fmt.Errorf("could not read @argfile %s, err: %s", filename, err.Error())
+	}
+	return argFile, nil
+}
+
+// loadArgFile reads an ArgFile and merges the argfiles it includes before it. The command of the last file that has one
+// is used, the args and env are appended in order and a profile replaces a profile of the same name in an included file.
+// 'including' are the files that include this one, to detect cycles and describe errors.
+func loadArgFile(filename string, including []string) (ArgFile, error) {
+	chain := append(append([]string{}, including...), filename)
+	for _, f := range including {
+		if sameFile(f, filename) {
+			return ArgFile{}, fmt.Errorf("@argfile include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	argFile, err := readArgFile(filename)
+	if err != nil {
+		if len(including) > 0 {
+			return ArgFile{}, fmt.Errorf("%s, included by %s", err.Error(), strings.Join(including, " -> "))
+		}
+		return ArgFile{}, err
+	}
+	var merged ArgFile
+	for _, include := range argFile.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(filename), include)
+		}
+		included, err := loadArgFile(include, chain)
+		if err != nil {
+			return ArgFile{}, err
+		}
+		merged.merge(included)
+	}
+	expand := argFileExpander(filename)
+	for i, arg := range argFile.Args {
+		argFile.Args[i] = expand(arg)
+		argFile.sources = append(argFile.sources, Source{Kind: FromArgFile, Name: filename, Position: i})
+	}
+	argFile.Env = expandAll(argFile.Env, expand)
+	for name, profile := range argFile.Profiles {
+		profile.file = filename
+		profile.Args = expandAll(profile.Args, expand)
+		profile.Env = expandAll(profile.Env, expand)
+		argFile.Profiles[name] = profile
+	}
+	merged.merge(argFile)
+	merged.Include = argFile.Include
+	return merged, nil
+}
+
+// argFileExpander replaces $ARGFILE and $ARGFILE_DIR with the absolute path and directory of the argfile,
+// other variables are expanded later, with the environment of the argfiles
+func argFileExpander(filename string) func(string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	vars := map[string]string{"ARGFILE": filename, "ARGFILE_DIR": filepath.Dir(filename)}
+	return func(s string) string {
+		return os.Expand(s, func(name string) string {
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			return "${" + name + "}"
+		})
+	}
+}
+
+func expandAll(values []string, expand func(string) string) []string {
+	var expanded []string
+	for _, value := range values {
+		expanded = append(expanded, expand(value))
+	}
+	return expanded
+}
+
+// resolveArgFilePaths joins the relative paths read from an argfile to the directory of the argfile, for string fields with
+// the 'file' or 'dir' validation, or the 'path' option, eg. `flag:"cert,path"`
+func (s flagSet) resolveArgFilePaths(c *flagCollector) {
+	for _, f := range c.flags {
+		source := s.sources[f.name]
+		if !f.path || source.Kind != FromArgFile || f.field.Kind() != reflect.String {
+			continue
+		}
+		if path := f.field.String(); path != "" && !filepath.IsAbs(path) {
+			dir := filepath.Dir(source.Name)
+			// like $ARGFILE_DIR, the directory is absolute when the argfile was named relative to the working directory
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			f.field.SetString(filepath.Join(dir, path))
+		}
+	}
+}
+
+// isPathValidation reports whether a validate tag has the 'file' or 'dir' rule, eg. 'file' or 'file=exists'
+func isPathValidation(validate string) bool {
+	for _, rule := range strings.FieldsFunc(validate, func(r rune) bool { return r == ',' || r == '|' }) {
+		if name := strings.SplitN(rule, "=", 2)[0]; name == "file" || name == "dir" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ArgFile) merge(other ArgFile) {
+	if len(other.Command) > 0 {
+		a.Command = other.Command
+	}
+	a.Args = append(a.Args, other.Args...)
+	a.sources = append(a.sources, other.sources...)
+	a.Env = append(a.Env, other.Env...)
+	for name, profile := range other.Profiles {
+		if a.Profiles == nil {
+			a.Profiles = map[string]ArgFileProfile{}
+		}
+		a.Profiles[name] = profile
+	}
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// unmarshalJSON adds the line of a syntax or type error to its message, like the YAML and TOML decoders do
+func unmarshalJSON(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	var offset int64
+	switch t := err.(type) {
+	case *json.SyntaxError:
+		offset = t.Offset
+	case *json.UnmarshalTypeError:
+		offset = t.Offset
+	default:
+		return err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return fmt.Errorf("line %d: %s", bytes.Count(data[:offset], []byte("\n"))+1, err.Error())
+}
+
+// splitResponseFile splits the text of a response file into arguments, like a shell does. Arguments are separated by whitespace,
+// usually one per line, '#' starts a comment, and quotes and '\' keep whitespace, eg. "--name=a b" or --name=a\ b.
+// A '\' at the end of a line continues the argument on the next line.
+func splitResponseFile(text string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	line, quoteLine := 1, 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' {
+			line++
+		}
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				arg.WriteRune(runes[i+1])
+				i++
+			default:
+				arg.WriteRune(r)
+			}
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case r == '#' && !inArg:
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("line %d: '\\' at the end of the file", line)
+			}
+			i++
+			if runes[i] == '\n' {
+				line++
+				continue
+			}
+			if runes[i] == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+				line++
+				i++
+				continue
+			}
+			arg.WriteRune(runes[i])
+			inArg = true
+		case r == '\'' || r == '"':
+			quote, quoteLine = r, line
+			inArg = true
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("line %d: missing closing %c", quoteLine, quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
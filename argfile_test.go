@@ -0,0 +1,303 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitResponseFile(t *testing.T) {
+	args, err := splitResponseFile(`# a comment
+--name=a
+--level "two words"   # a comment after an argument
+--hosts='single "quoted"' --hosts="double \"quoted\" \\ $HOME"
+--labels=a=b\ c
+--name=a#b
+--continued=a\
+b
+""
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"--name=a",
+		"--level", "two words",
+		"--hosts=single \"quoted\"", "--hosts=double \"quoted\" \\ $HOME",
+		"--labels=a=b c",
+		"--name=a#b",
+		"--continued=ab",
+		"",
+	}, args)
+
+	args, err = splitResponseFile("--name=a\r\n--level=b\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--name=a", "--level=b"}, args)
+
+	args, err = splitResponseFile("  \n# only comments\n")
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	_, err = splitResponseFile("--name=a\n--level='b\nc\n")
+	assert.EqualError(t, err, "line 2: missing closing '")
+	_, err = splitResponseFile("--name=a\\")
+	assert.EqualError(t, err, "line 1: '\\' at the end of the file")
+}
+
+func TestArgFile_ResponseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var result configFlags
+	var sources Sources
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			result = f
+			sources = GetSources(ctx)
+			return nil
+		}),
+	}
+
+	filename := filepath.Join(dir, "args.txt")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("# serve with defaults\nserve\n--name 'a b'\n--nested.port=1\n"), 0600))
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + filename, "--level=cli"}))
+	assert.Equal(t, configFlags{Name: "a b", Level: "cli", Nested: configNested{Port: 1}}, result)
+	assert.Equal(t, Source{Kind: FromArgFile, Name: filename, Position: 1}, sources["name"])
+	assert.Equal(t, Source{Kind: FromCommandLine}, sources["level"])
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("serve\n--name \"a b\n"), 0600))
+	require.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + filename}),
+		"could not read @argfile "+filename+", err: line 2: missing closing \"")
+}
+
+func TestArgFile_Formats(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var result configFlags
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			result = f
+			return nil
+		}),
+	}
+
+	for name, data := range map[string]string{
+		"args.yaml": "# a comment\ncommand: [serve]\nargs:\n  - --name=a b\n  - --level=$TEST_ARGFILE_LEVEL\n  - --nested.port=1\nenv:\n  - TEST_ARGFILE_LEVEL=debug\n",
+		"args.yml":  "command: [serve]\nargs: [--name=a b, --level=$TEST_ARGFILE_LEVEL, --nested.port=1]\nenv: [TEST_ARGFILE_LEVEL=debug]\n",
+		"args.toml": "# a comment\ncommand = [\"serve\"]\nargs = [\n  \"--name=a b\",\n  \"--level=$TEST_ARGFILE_LEVEL\",\n  \"--nested.port=1\",\n]\nenv = [\"TEST_ARGFILE_LEVEL=debug\"]\n",
+		"args.json": `{"command": ["serve"], "args": ["--name=a b", "--level=$TEST_ARGFILE_LEVEL", "--nested.port=1"], "env": ["TEST_ARGFILE_LEVEL=debug"]}`,
+	} {
+		result = configFlags{}
+		filename := writeConfigFile(t, dir, name, data)
+		require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + filename}), name)
+		assert.Equal(t, configFlags{Name: "a b", Level: "debug", Nested: configNested{Port: 1}}, result, name)
+	}
+
+	for name, tc := range map[string]struct{ data, err string }{
+		"bad.yaml":  {"command: [serve]\nargs: [--name\n", "yaml: line 2: did not find expected ',' or ']'"},
+		"type.yaml": {"command: [serve]\nargs:\n  a: b\n", "yaml: unmarshal errors:\n  line 3: cannot unmarshal !!map into []string"},
+		"bad.toml":  {"command = [\"serve\"]\nargs = [\"--name\"\n", "Near line 2 (last key parsed 'args'): expected a comma or array terminator ']', but got end of file instead"},
+		"bad.json":  {"{\n  \"command\": [\"serve\"],\n  \"args\": [\"--name\",]\n}", "line 3: invalid character ']' looking for beginning of value"},
+		"type.json": {"{\n  \"command\": [\"serve\"],\n  \"args\": \"--name\"\n}", "line 3: json: cannot unmarshal string into Go struct field ArgFile.args of type []string"},
+		// a .json file is not a response file
+		"args.json": {"serve --name=a", "line 1: invalid character 's' looking for beginning of value"},
+	} {
+		filename := writeConfigFile(t, dir, name, tc.data)
+		assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + filename}), "could not read @argfile "+filename+", err: "+tc.err, name)
+	}
+}
+
+func TestArgFile_Include(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "common"), 0700))
+
+	var result configFlags
+	var sources Sources
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			result = f
+			sources = GetSources(ctx)
+			return nil
+		}),
+	}
+
+	base := writeConfigFile(t, dir, "common/base.yaml", "include: [port.txt]\ncommand: [serve]\nargs: [--name=base, --nested.host=$TEST_ARGFILE_HOST]\nenv: [TEST_ARGFILE_HOST=base]\n")
+	port := writeConfigFile(t, dir, "common/port.txt", "--nested.port=1\n")
+	prod := writeConfigFile(t, dir, "prod.json", `{"include": ["common/base.yaml"], "args": ["--name=prod"], "env": ["TEST_ARGFILE_HOST=prod"]}`)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + prod}))
+	assert.Equal(t, configFlags{Name: "prod", Nested: configNested{Host: "prod", Port: 1}}, result)
+	assert.Equal(t, Source{Kind: FromArgFile, Name: prod}, sources["name"])
+	assert.Equal(t, Source{Kind: FromArgFile, Name: base, Position: 1}, sources["nested.host"])
+	assert.Equal(t, Source{Kind: FromArgFile, Name: port}, sources["nested.port"])
+
+	writeConfigFile(t, dir, "common/port.txt", "--nested.port=1 'a\n")
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + prod}),
+		"could not read @argfile "+port+", err: line 1: missing closing ', included by "+prod+" -> "+base)
+
+	writeConfigFile(t, dir, "common/base.yaml", "include: [../prod.json]\n")
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + prod}),
+		"@argfile include cycle: "+prod+" -> "+base+" -> "+prod)
+}
+
+func TestArgFile_Multiple(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var result configFlags
+	var sources Sources
+	var remaining []string
+	commands := Commands{
+		NewCommandGroup("cluster", "",
+			NewCommand("deploy", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+				result = f
+				sources = GetSources(ctx)
+				remaining = GetRemainingArgs(ctx)
+				return nil
+			}),
+		),
+	}
+
+	deploy := writeConfigFile(t, dir, "deploy.yaml", "command: [deploy]\nargs: [--nested.port=1]\n")
+	common := writeConfigFile(t, dir, "common.json", `{"args": ["--name=common", "--level=common"]}`)
+	prod := writeConfigFile(t, dir, "prod.txt", "--level=prod\n")
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "deploy", "@" + common, "@" + prod, "--nested.port=3"}))
+	assert.Equal(t, configFlags{Name: "common", Level: "prod", Nested: configNested{Port: 3}}, result)
+	assert.Equal(t, Source{Kind: FromArgFile, Name: common}, sources["name"])
+	assert.Equal(t, Source{Kind: FromArgFile, Name: prod}, sources["level"])
+	assert.Equal(t, Source{Kind: FromCommandLine}, sources["nested.port"])
+
+	// an argfile can have the command, '@@' escapes a '@' and the arguments after '--' are not expanded
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "@" + deploy, "@" + common, "@@name", "--", "@" + prod, "@@name"}))
+	assert.Equal(t, configFlags{Name: "common", Level: "common", Nested: configNested{Port: 1}}, result)
+	assert.Equal(t, Source{Kind: FromArgFile, Name: deploy}, sources["nested.port"])
+	assert.Equal(t, []string{"@name", "--", "@" + prod, "@@name"}, remaining)
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "deploy", "@" + filepath.Join(dir, "missing.json")}),
+		"could not open @argfile, err: open "+filepath.Join(dir, "missing.json")+": no such file or directory")
+}
+
+func TestArgFile_Env(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	type envFlags struct {
+		Name  string `flag:"name" env:"TEST_ARGFILE_NAME"`
+		Cache string `flag:"cache" default:"${TEST_ARGFILE_DIR}/cache"`
+	}
+	var result envFlags
+	var sources Sources
+	var environ []string
+	commands := Commands{
+		NewCommand("serve", envFlags{}, "", func(ctx context.Context, f envFlags) error {
+			result = f
+			sources = GetSources(ctx)
+			environ = Environ(ctx)
+			return nil
+		}),
+	}
+
+	withEnv := writeConfigFile(t, dir, "env.yaml", "command: [serve]\nenv: [TEST_ARGFILE_DIR=/var/app, TEST_ARGFILE_NAME=$TEST_ARGFILE_DIR]\n")
+	withoutEnv := writeConfigFile(t, dir, "no-env.yaml", "command: [serve]\n")
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + withEnv}))
+	assert.Equal(t, envFlags{Name: "/var/app", Cache: "/var/app/cache"}, result)
+	assert.Equal(t, Source{Kind: FromEnv, Name: "TEST_ARGFILE_NAME"}, sources["name"])
+	assert.Contains(t, environ, "TEST_ARGFILE_NAME=/var/app")
+	_, isSet := os.LookupEnv("TEST_ARGFILE_NAME")
+	assert.False(t, isSet)
+
+	// the environment of a previous run is not kept
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + withoutEnv}))
+	assert.Equal(t, envFlags{Cache: "/cache"}, result)
+	assert.NotContains(t, environ, "TEST_ARGFILE_NAME=/var/app")
+
+	defer os.Unsetenv("TEST_ARGFILE_DIR")
+	defer os.Unsetenv("TEST_ARGFILE_NAME")
+	ctx := WithOptions(context.TODO(), Options{ExportArgFileEnv: true})
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "@" + withEnv}))
+	assert.Equal(t, "/var/app", os.Getenv("TEST_ARGFILE_NAME"))
+
+	invalid := writeConfigFile(t, dir, "invalid.yaml", "command: [serve]\nenv: [TEST_ARGFILE_NAME]\n")
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + invalid}),
+		"invalid env \"TEST_ARGFILE_NAME\" in @argfile "+invalid+", expected NAME=value")
+}
+
+func TestArgFile_Paths(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app/certs"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "common"), 0700))
+	ca := writeConfigFile(t, dir, "app/certs/ca.pem", "")
+
+	type pathFlags struct {
+		Cert   string `flag:"cert" validate:"file"`
+		Log    string `flag:"log"`
+		Out    string `flag:"out,path"`
+		Name   string `flag:"name"`
+		Input  string `flag:"<input>" validate:"required,file"`
+		Config string `flag:"config" validate:"omitempty,file"`
+	}
+	var result pathFlags
+	commands := Commands{
+		NewCommand("serve <input>", pathFlags{}, "", func(ctx context.Context, f pathFlags) error {
+			result = f
+			return nil
+		}),
+	}
+
+	writeConfigFile(t, dir, "common/common.yaml", "args: [--out=out, --log=$ARGFILE_DIR/log.txt]\n")
+	args := writeConfigFile(t, dir, "app/args.yaml", "include: [../common/common.yaml]\ncommand: [serve]\nargs: [--cert=certs/ca.pem, --name=certs/ca.pem]\n")
+	input := writeConfigFile(t, dir, "app/input.txt", "certs/ca.pem\n")
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + args, "@" + input}))
+	assert.Equal(t, pathFlags{
+		Cert:  ca,
+		Log:   filepath.Join(dir, "common/log.txt"),
+		Out:   filepath.Join(dir, "common/out"),
+		Name:  "certs/ca.pem",
+		Input: ca,
+	}, result)
+
+	// a path on the command line is relative to the working directory
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + args, "--out=out", "--config=" + ca, "@" + input}))
+	assert.Equal(t, "out", result.Out)
+	assert.Equal(t, ca, result.Config)
+
+	writeConfigFile(t, dir, "app/args.txt", "serve\n--cert $ARGFILE\n$ARGFILE_DIR/certs/ca.pem\n")
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "@" + filepath.Join(dir, "app/args.txt")}))
+	assert.Equal(t, filepath.Join(dir, "app/args.txt"), result.Cert)
+	assert.Equal(t, ca, result.Input)
+
+	// a rule with parameters marks a path too, and an argfile named relative to the working directory gives an absolute path
+	type certFlags struct {
+		CA string `flag:"ca" validate:"file=absolute,file=exists"`
+	}
+	var cert certFlags
+	commands = Commands{
+		NewCommand("serve", certFlags{}, "", func(ctx context.Context, f certFlags) error {
+			cert = f
+			return nil
+		}),
+	}
+	writeConfigFile(t, dir, "app/ca.args", "--ca certs/ca.pem\n")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	abs, err := filepath.Abs("app/certs/ca.pem")
+	require.NoError(t, err)
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "serve", "@app/ca.args"}))
+	assert.Equal(t, abs, cert.CA)
+}
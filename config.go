@@ -0,0 +1,389 @@
+package struct_flags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configFile is a config file decoded into nested maps, see Options.ConfigFiles
+type configFile struct {
+	name string
+	// key is the key of the values in the file, eg. "profiles.prod."
+	key    string
+	values map[string]interface{}
+}
+
+// loadConfigFiles reads the config files, the format is chosen by the extension: .json, .yaml, .yml or .toml
+func loadConfigFiles(names []string) ([]configFile, error) {
+	files := []configFile{}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not open config file, err: %s", err.Error())
+		}
+		values := map[string]interface{}{}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".json":
+			d := json.NewDecoder(bytes.NewReader(data))
+			d.UseNumber()
+			err = d.Decode(&values)
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, &values)
+		case ".toml":
+			_, err = toml.Decode(string(data), &values)
+		default:
+			return nil, fmt.Errorf("unsupported config file %s, expected .json, .yaml, .yml or .toml", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file %s, err: %s", name, err.Error())
+		}
+		files = append(files, configFile{name: name, values: normalizeConfigValue(values).(map[string]interface{})})
+	}
+	return files, nil
+}
+
+// normalizeConfigValue converts the maps decoded from YAML to maps with string keys
+func normalizeConfigValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			m[fmt.Sprint(k)] = normalizeConfigValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		for k, v := range t {
+			t[k] = normalizeConfigValue(v)
+		}
+		return t
+	case []interface{}:
+		for i, v := range t {
+			t[i] = normalizeConfigValue(v)
+		}
+		return t
+	default:
+		return value
+	}
+}
+
+var configKey = contextKey{value: 10}
+
+// getConfig returns the config files read by Commands.Run, or nil if they were not read
+func getConfig(ctx context.Context) []configFile {
+	files, _ := ctx.Value(configKey).([]configFile)
+	return files
+}
+
+// loadConfig reads the config files once for the Commands tree, and checks that every key is a flag or a command.
+// The --config and --profile flags are taken out of the arguments, see Options.ConfigFlag and Options.Profiles.
+func (cs Commands) loadConfig(ctx context.Context, args []string) (context.Context, []string, error) {
+	options := getOptions(ctx)
+	if len(options.ConfigFiles) == 0 && options.ConfigName == "" && !options.ConfigFlag && !options.Profiles || getConfig(ctx) != nil || len(getParentCommands(ctx)) > 0 {
+		return ctx, args, nil
+	}
+	flagValues, args, err := extractOptionFlags(args, options)
+	if err != nil {
+		return ctx, args, err
+	}
+	names, err := configFileNames(options, flagValues[configFlagName])
+	if err != nil {
+		return ctx, args, err
+	}
+	files, err := loadConfigFiles(names)
+	if err != nil {
+		return ctx, args, err
+	}
+	p := selectProfile(options, flagValues[profileFlagName])
+	profiles := profileFiles(files)
+	if files, err = applyProfile(files, p); err != nil {
+		return ctx, args, err
+	}
+	var flagSets []*flag.FlagSet
+	for _, defaults := range []interface{}{options.RootFlags, options.GlobalFlags} {
+		if fs := lookupConfigFlags(defaults, options); fs != nil {
+			flagSets = append(flagSets, fs)
+		}
+	}
+	for _, f := range append(append([]configFile{}, files...), profiles...) {
+		if err := checkConfigKeys(f.name, f.key, f.values, flagSets, cs, options); err != nil {
+			return ctx, args, err
+		}
+	}
+	ctx = context.WithValue(ctx, configKey, files)
+	if p != nil {
+		ctx = context.WithValue(ctx, profileKey, p)
+	}
+	return ctx, args, nil
+}
+
+// lookupConfigFlags returns the flags of a flags struct, or nil if there are none
+func lookupConfigFlags(defaults interface{}, options Options) *flag.FlagSet {
+	if defaults == nil || reflect.Indirect(reflect.ValueOf(defaults)).Kind() != reflect.Struct {
+		return nil
+	}
+	return lookupFlags(defaults, options)
+}
+
+// checkConfigKeys returns an error for the first key that is not a flag of 'flagSets', or a section for one of 'commands'.
+// A key is a flag name, eg. 'nested.string1', or a map of the names after the prefix, eg. 'nested: {string1: ...}'.
+func checkConfigKeys(file, section string, values map[string]interface{}, flagSets []*flag.FlagSet, commands Commands, options Options) error {
+	var check func(prefix string, values map[string]interface{}) error
+	check = func(prefix string, values map[string]interface{}) error {
+		for _, key := range sortedConfigKeys(values) {
+			name := prefix + key
+			m, isMap := values[key].(map[string]interface{})
+			switch {
+			case lookupConfigFlag(flagSets, name) != nil:
+			case isMap && hasFlagPrefix(flagSets, name+"."):
+				if err := check(name+".", m); err != nil {
+					return err
+				}
+			case isMap && prefix == "" && findConfigCommand(commands, key) != nil:
+				if err := checkCommandConfigKeys(file, section+key+".", m, findConfigCommand(commands, key), options); err != nil {
+					return err
+				}
+			default:
+				return unknownConfigKey(file, section, name, flagSets, commands)
+			}
+		}
+		return nil
+	}
+	return check("", values)
+}
+
+// checkCommandConfigKeys checks the section of a command, or a command group with its flags and commands
+func checkCommandConfigKeys(file, section string, values map[string]interface{}, c ICommand, options Options) error {
+	var flagSets []*flag.FlagSet
+	var commands Commands
+	switch t := c.(type) {
+	case Command:
+		if fs := lookupConfigFlags(t.DefaultFlags(), options); fs != nil {
+			flagSets = append(flagSets, fs)
+		}
+	case CommandGroup:
+		if g, ok := c.(CommandGroupFlags); ok {
+			if fs := lookupConfigFlags(g.DefaultFlags(), options); fs != nil {
+				flagSets = append(flagSets, fs)
+			}
+		}
+		commands = t.Commands()
+	}
+	return checkConfigKeys(file, section, values, flagSets, commands, options)
+}
+
+func unknownConfigKey(file, section, name string, flagSets []*flag.FlagSet, commands Commands) error {
+	var candidates []string
+	for _, fs := range flagSets {
+		fs.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, f.Name)
+		})
+	}
+	for _, c := range commands {
+		candidates = append(candidates, strings.ToLower(c.Name()))
+	}
+	if suggestion := suggest(name, candidates); suggestion != "" {
+		return fmt.Errorf("unknown key \"%s\" in config file %s, did you mean \"%s\"?", section+name, file, section+suggestion)
+	}
+	return fmt.Errorf("unknown key \"%s\" in config file %s", section+name, file)
+}
+
+func lookupConfigFlag(flagSets []*flag.FlagSet, name string) *flag.Flag {
+	for _, fs := range flagSets {
+		if f := fs.Lookup(name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+func hasFlagPrefix(flagSets []*flag.FlagSet, prefix string) bool {
+	found := false
+	for _, fs := range flagSets {
+		fs.VisitAll(func(f *flag.Flag) {
+			found = found || strings.HasPrefix(f.Name, prefix)
+		})
+	}
+	return found
+}
+
+// findConfigCommand finds a command by its name, a section is not read for an alias
+func findConfigCommand(commands Commands, name string) ICommand {
+	for _, c := range commands {
+		if strings.ToLower(c.Name()) == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func sortedConfigKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configLayer holds the values of a config file for a flag set, by flag name
+type configLayer struct {
+	file string
+	// section is the key of the values for the flag set, eg. "cluster.nodes." or "profiles.prod.cluster.nodes."
+	section string
+	values  map[string]interface{}
+}
+
+// configLayers returns the sections of the config files for the command path, a later file overrides an earlier one
+func configLayers(files []configFile, path []string) []configLayer {
+	var layers []configLayer
+	for _, f := range files {
+		values := f.values
+		for _, name := range path {
+			values, _ = values[name].(map[string]interface{})
+		}
+		if values == nil {
+			continue
+		}
+		flat := map[string]interface{}{}
+		flattenConfig("", values, flat)
+		layers = append(layers, configLayer{file: f.name, section: f.key + strings.Join(append(append([]string{}, path...), ""), "."), values: flat})
+	}
+	return layers
+}
+
+// flattenConfig adds the values of nested maps by their full name, eg. 'nested.string1', the maps are kept for flags of map types
+func flattenConfig(prefix string, values map[string]interface{}, flat map[string]interface{}) {
+	for k, v := range values {
+		flat[prefix+k] = v
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenConfig(prefix+k+".", m, flat)
+		}
+	}
+}
+
+// readConfig sets the flag from the last config file with its name, see Options.ConfigFiles.
+// The value is shown as the default in usage.
+func (c *flagCollector) readConfig(info *flagInfo, f *flag.Flag, value reflect.Value) error {
+	for i := len(c.config) - 1; i >= 0; i-- {
+		layer := c.config[i]
+		configValue, ok := layer.values[info.name]
+		if !ok {
+			continue
+		}
+		key := layer.section + info.name
+		if err := setConfigValue(f, value, configValue); err != nil {
+			if s, scalarErr := formatConfigScalar(configValue); scalarErr == nil {
+				return fmt.Errorf("invalid value \"%s\" for key %s in config file %s (flag -%s): %s", s, key, layer.file, info.name, numError(err).Error())
+			}
+			return fmt.Errorf("invalid value for key %s in config file %s (flag -%s): %s", key, layer.file, info.name, err.Error())
+		}
+		f.DefValue = f.Value.String()
+		if r, ok := f.Value.(resettable); ok {
+			r.reset()
+		}
+		info.source = Source{Kind: FromConfig, Name: layer.file, Key: key}
+		return nil
+	}
+	return nil
+}
+
+// setConfigValue sets a flag from a decoded value. Lists and maps are set to slice and map flags by element,
+// other values are parsed like the command line, eg. "a,b" for a slice.
+func setConfigValue(f *flag.Flag, value reflect.Value, configValue interface{}) error {
+	switch t := configValue.(type) {
+	case []interface{}:
+		if _, ok := f.Value.(*sliceValue); !ok {
+			return errors.New("expected a single value, got a list")
+		}
+		values := reflect.MakeSlice(value.Type(), len(t), len(t))
+		for i, e := range t {
+			s, err := formatConfigScalar(e)
+			if err != nil {
+				return err
+			}
+			if err := setScalar(values.Index(i), s); err != nil {
+				return err
+			}
+		}
+		value.Set(values)
+		return nil
+	case map[string]interface{}:
+		if _, ok := f.Value.(*mapValue); !ok {
+			return errors.New("expected a single value, got a map")
+		}
+		entries := reflect.MakeMap(value.Type())
+		for _, k := range sortedConfigKeys(t) {
+			s, err := formatConfigScalar(t[k])
+			if err != nil {
+				return err
+			}
+			v := reflect.New(value.Type().Elem()).Elem()
+			if err := setScalar(v, s); err != nil {
+				return err
+			}
+			key := reflect.New(value.Type().Key()).Elem()
+			key.SetString(k)
+			entries.SetMapIndex(key, v)
+		}
+		value.Set(entries)
+		return nil
+	default:
+		s, err := formatConfigScalar(configValue)
+		if err != nil {
+			return err
+		}
+		return setFlagValue(f, value, s)
+	}
+}
+
+// formatConfigScalar formats a decoded value to be parsed like the command line
+func formatConfigScalar(value interface{}) (string, error) {
+	switch t := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	case []interface{}, []map[string]interface{}:
+		return "", errors.New("expected a single value, got a list")
+	case map[string]interface{}:
+		return "", errors.New("expected a single value, got a map")
+	default:
+		return fmt.Sprint(t), nil
+	}
+}
+
+// checkConfig returns the errors of the values read from config files, like checkEnv an invalid value is not an error
+// when its flag was set on the command line, or by the environment which is preferred to the config files
+func (c *flagCollector) checkConfig() error {
+	set := map[string]bool{}
+	c.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var errs []string
+	for _, f := range c.flags {
+		if f.configErr != nil && !set[f.name] && f.source.Kind != FromEnv {
+			errs = append(errs, f.configErr.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
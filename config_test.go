@@ -0,0 +1,180 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type configNested struct {
+	Host string `flag:"host"`
+	Port int    `flag:"port" validate:"min=1"`
+}
+
+type configFlags struct {
+	Name    string            `flag:"name"`
+	Level   string            `flag:"level" env:"TEST_CONFIG_LEVEL"`
+	Timeout time.Duration     `flag:"timeout"`
+	Hosts   []string          `flag:"hosts"`
+	Labels  map[string]string `flag:"labels"`
+	Nested  configNested      `flag:"nested"`
+}
+
+func writeConfigFile(t *testing.T, dir, name, data string) string {
+	filename := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(filename, []byte(data), 0600))
+	return filename
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	expected := configFlags{
+		Name:    "a",
+		Level:   "info",
+		Timeout: time.Minute,
+		Hosts:   []string{"x,1", "z"},
+		Labels:  map[string]string{"env": "prod"},
+		Nested:  configNested{Host: "h", Port: 8080},
+	}
+
+	files := map[string]string{
+		"config.json": `{"name": "a", "level": "info", "timeout": "1m", "hosts": ["x,1", "z"], "labels": {"env": "prod"}, "nested": {"host": "h", "port": 8080}}`,
+		"config.yaml": "name: a\nlevel: info\ntimeout: 1m\nhosts: [\"x,1\", z]\nlabels:\n  env: prod\nnested.host: h\nnested:\n  port: 8080\n",
+		"config.toml": "name = \"a\"\nlevel = \"info\"\ntimeout = \"1m\"\nhosts = [\"x,1\", \"z\"]\n\n[labels]\nenv = \"prod\"\n\n[nested]\nhost = \"h\"\nport = 8080\n",
+	}
+	for name, data := range files {
+		filename := writeConfigFile(t, dir, name, data)
+		var flags configFlags
+		_, err := NewFlagSetWithOptions("", configFlags{}, Options{ConfigFiles: []string{filename}}).UnmarshalFlags([]string{}, &flags)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, flags, name)
+	}
+}
+
+func TestConfigFiles_Precedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	base := writeConfigFile(t, dir, "base.yaml", "name: base\nlevel: base\nnested:\n  host: base\n  port: 1\n")
+	local := writeConfigFile(t, dir, "local.json", `{"nested": {"port": 2}}`)
+	require.NoError(t, os.Setenv("TEST_CONFIG_LEVEL", "env"))
+	defer os.Unsetenv("TEST_CONFIG_LEVEL")
+
+	fs := NewFlagSetWithOptions("", configFlags{Timeout: time.Second}, Options{ConfigFiles: []string{base, local}})
+	var flags configFlags
+	_, err = fs.UnmarshalFlags([]string{"--name=cli"}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, configFlags{Name: "cli", Level: "env", Timeout: time.Second, Nested: configNested{Host: "base", Port: 2}}, flags)
+	assert.Equal(t, Source{Kind: FromConfig, Name: local, Key: "nested.port"}, fs.(FlagSetSources).Sources()["nested.port"])
+	assert.Equal(t, Source{Kind: FromConfig, Name: base, Key: "nested.host"}, fs.(FlagSetSources).Sources()["nested.host"])
+}
+
+func TestConfigFiles_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	unmarshal := func(data string) error {
+		filename := writeConfigFile(t, dir, "config.yaml", data)
+		var flags configFlags
+		_, err := NewFlagSetWithOptions("", configFlags{}, Options{ConfigFiles: []string{filename}}).UnmarshalFlags([]string{}, &flags)
+		return err
+	}
+	filename := filepath.Join(dir, "config.yaml")
+
+	require.EqualError(t, unmarshal("nested:\n  prot: 1\n"), "unknown key \"nested.prot\" in config file "+filename+", did you mean \"nested.port\"?")
+	require.EqualError(t, unmarshal("other: 1\n"), "unknown key \"other\" in config file "+filename)
+	require.EqualError(t, unmarshal("nested:\n  port: abc\n"), "invalid value \"abc\" for key nested.port in config file "+filename+" (flag -nested.port): parse error")
+	require.EqualError(t, unmarshal("name: [a, b]\n"), "invalid value for key name in config file "+filename+" (flag -name): expected a single value, got a list")
+
+	_, err = NewFlagSetWithOptions("", configFlags{}, Options{ConfigFiles: []string{filepath.Join(dir, "config.ini")}}).UnmarshalFlags([]string{}, &configFlags{})
+	require.Error(t, err)
+}
+
+func TestConfigFiles_InvalidValueOverridden(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := writeConfigFile(t, dir, "config.yaml", "level: [a, b]\nnested:\n  port: abc\n")
+	fs := NewFlagSetWithOptions("", configFlags{}, Options{ConfigFiles: []string{filename}})
+
+	// like an invalid environment variable, an invalid value is ignored when the command line or the environment sets the flag
+	require.NoError(t, os.Setenv("TEST_CONFIG_LEVEL", "env"))
+	defer os.Unsetenv("TEST_CONFIG_LEVEL")
+	var flags configFlags
+	_, err = fs.UnmarshalFlags([]string{"--nested.port=2"}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, configFlags{Level: "env", Nested: configNested{Port: 2}}, flags)
+
+	_, err = fs.UnmarshalFlags([]string{}, &flags)
+	require.EqualError(t, err, "invalid value \"abc\" for key nested.port in config file "+filename+" (flag -nested.port): parse error")
+}
+
+func TestConfigFiles_Constraints(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := writeConfigFile(t, dir, "config.yaml", "url: http://example.com\n")
+	fs := NewFlagSetWithOptions("", sourceFlags{}, Options{ConfigFiles: []string{filename}})
+
+	var flags sourceFlags
+	_, err = fs.UnmarshalFlags([]string{}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", flags.URL)
+
+	// a value of the config file counts as set, like the environment
+	_, err = fs.UnmarshalFlags([]string{"--file=a"}, &flags)
+	require.EqualError(t, err, "exactly one of the flags -file, -url is required, got -file, -url")
+}
+
+func TestConfigFiles_Commands(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	type Globals struct {
+		Verbose bool `flag:"verbose"`
+	}
+	type Cluster struct {
+		Context string `flag:"context"`
+	}
+
+	var result configFlags
+	var cluster Cluster
+	var globals Globals
+	commands := Commands{
+		NewCommandGroupWithFlags("cluster", "", Cluster{},
+			NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+				GetGroupFlags(ctx, &cluster)
+				GetGlobalFlags(ctx, &globals)
+				result = f
+				return nil
+			}),
+		),
+	}
+
+	filename := writeConfigFile(t, dir, "config.yaml", "verbose: true\ncluster:\n  context: prod\n  serve:\n    nested:\n      port: 0\n")
+	ctx := WithOptions(context.TODO(), Options{GlobalFlags: Globals{}, ConfigFiles: []string{filename}})
+
+	err = commands.Run(ctx, []string{"<exe>", "cluster", "serve"})
+	require.EqualError(t, err, "invalid value \"0\" for flag -nested.port (from config file "+filename+", key cluster.serve.nested.port): validation failed for rule 'min=1'")
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "cluster", "serve", "--nested.port=1"}))
+	assert.Equal(t, 1, result.Nested.Port)
+	assert.Equal(t, "prod", cluster.Context)
+	assert.True(t, globals.Verbose)
+
+	writeConfigFile(t, dir, "config.yaml", "cluster:\n  serv:\n    name: a\n")
+	require.EqualError(t, commands.Run(ctx, []string{"<exe>", "cluster", "serve"}), "unknown key \"cluster.serv\" in config file "+filename+", did you mean \"cluster.serve\"?")
+}
@@ -0,0 +1,160 @@
+package struct_flags
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const configFlagName = "config"
+
+// systemConfigDir is the directory with a directory of config files for each app
+var systemConfigDir = "/etc"
+
+var configExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// GetConfigFiles returns the names of the config files that were read, in order
+func GetConfigFiles(ctx context.Context) []string {
+	var names []string
+	for _, f := range getConfig(ctx) {
+		// the profiles of a file follow it
+		if len(names) == 0 || names[len(names)-1] != f.name {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// configFileNames returns Options.ConfigFiles followed by the files of the --config flag, the environment variable
+// <NAME>_CONFIG, or the files found for Options.ConfigName, in that order of preference
+func configFileNames(options Options, flagFiles []string) ([]string, error) {
+	names := append([]string{}, options.ConfigFiles...)
+	if len(flagFiles) > 0 {
+		return append(names, flagFiles...), nil
+	}
+	if options.ConfigName == "" {
+		return names, nil
+	}
+	if env, ok := os.LookupEnv(configEnvName(options)); ok {
+		for _, name := range filepath.SplitList(env) {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+	found, err := findConfigFiles(options.ConfigName)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, found...), nil
+}
+
+func configEnvName(options Options) string {
+	return envName(options.ConfigName, configFlagName)
+}
+
+// findConfigFiles returns the config files that exist in /etc/<name>/, $XDG_CONFIG_HOME/<name>/ and the working directory, in that order.
+// The files are named config.<ext> in the directories of the app, and <name>.<ext> in the working directory.
+func findConfigFiles(name string) ([]string, error) {
+	var candidates []string
+	dirs := []string{filepath.Join(systemConfigDir, name)}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, name))
+	}
+	for _, dir := range dirs {
+		for _, ext := range configExtensions {
+			candidates = append(candidates, filepath.Join(dir, "config"+ext))
+		}
+	}
+	for _, ext := range configExtensions {
+		candidates = append(candidates, name+ext)
+	}
+	var found []string
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not open config file, err: %s", err.Error())
+		}
+		if !info.IsDir() {
+			found = append(found, candidate)
+		}
+	}
+	return found, nil
+}
+
+// extractOptionFlags takes the --config and --profile flags out of the arguments before the first command name,
+// see Options.ConfigFlag and Options.Profiles. The values are returned by flag name.
+func extractOptionFlags(args []string, options Options) (values map[string][]string, remaining []string, err error) {
+	enabled := map[string]bool{configFlagName: options.ConfigFlag, profileFlagName: options.Profiles}
+	values = map[string][]string{}
+	if len(args) == 0 {
+		return values, args, nil
+	}
+	// the flags before the command name, to skip their values
+	var flagSets []*flag.FlagSet
+	for _, defaults := range []interface{}{options.RootFlags, options.GlobalFlags} {
+		if fs := lookupConfigFlags(defaults, options); fs != nil {
+			flagSets = append(flagSets, fs)
+		}
+	}
+	remaining = []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			remaining = append(remaining, args[i:]...)
+			break
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		value, hasValue := "", false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		if enabled[name] {
+			if !hasValue {
+				if i+1 == len(args) {
+					return nil, args, fmt.Errorf("flag needs an argument: -%s", name)
+				}
+				value = args[i+1]
+				i++
+			}
+			values[name] = append(values[name], value)
+			continue
+		}
+		remaining = append(remaining, arg)
+		if f := lookupConfigFlag(flagSets, name); f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			remaining = append(remaining, args[i+1])
+			i++
+		}
+	}
+	return values, remaining, nil
+}
+
+// rootUsageFlags returns the flags listed in the usage of the root commands
+func rootUsageFlags(options Options) *flag.FlagSet {
+	fs := lookupConfigFlags(options.RootFlags, options)
+	if fs == nil {
+		fs = flag.NewFlagSet("", flag.ContinueOnError)
+	}
+	if options.ConfigFlag {
+		usage := "a config file, that replaces the config files found, can be repeated"
+		if options.ConfigName != "" {
+			usage += " (env \"" + configEnvName(options) + "\")"
+		}
+		fs.String(configFlagName, "", usage)
+	}
+	if options.Profiles {
+		usage := "the profile of the config files and argfiles"
+		if env := profileEnvName(options); env != "" {
+			usage += " (env \"" + env + "\")"
+		}
+		fs.String(profileFlagName, "", usage)
+	}
+	return fs
+}
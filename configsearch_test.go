@@ -0,0 +1,77 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	previousSystemConfigDir := systemConfigDir
+	systemConfigDir = filepath.Join(dir, "etc")
+	defer func() { systemConfigDir = previousSystemConfigDir }()
+	require.NoError(t, os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg")))
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "wd"), 0700))
+	require.NoError(t, os.Chdir(filepath.Join(dir, "wd")))
+	defer os.Chdir(wd)
+
+	for _, d := range []string{"etc/app", "xdg/app"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, d), 0700))
+	}
+	etc := writeConfigFile(t, dir, "etc/app/config.yaml", "name: etc\nlevel: etc\nserve:\n  nested:\n    host: etc\n")
+	xdg := writeConfigFile(t, dir, "xdg/app/config.toml", "level = \"xdg\"\n")
+	writeConfigFile(t, dir, "wd/app.json", `{"serve": {"nested": {"port": 3}}}`)
+	other := writeConfigFile(t, dir, "other.yaml", "serve:\n  name: other\n  nested:\n    port: 1\n")
+
+	type Root struct {
+		Name  string `flag:"name"`
+		Level string `flag:"level"`
+	}
+
+	var root Root
+	var result configFlags
+	var files []string
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			GetRootFlags(ctx, &root)
+			files = GetConfigFiles(ctx)
+			result = f
+			return nil
+		}),
+	}
+	ctx := WithOptions(context.TODO(), Options{RootFlags: Root{}, ConfigName: "app", ConfigFlag: true})
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "serve"}))
+	assert.Equal(t, []string{etc, xdg, "app.json"}, files)
+	assert.Equal(t, Root{Name: "etc", Level: "xdg"}, root)
+	assert.Equal(t, configNested{Host: "etc", Port: 3}, result.Nested)
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--config", other, "--name=cli", "serve"}))
+	assert.Equal(t, []string{other}, files)
+	assert.Equal(t, Root{Name: "cli"}, root)
+	assert.Equal(t, "other", result.Name)
+
+	require.NoError(t, os.Setenv("APP_CONFIG", xdg+string(os.PathListSeparator)+other))
+	defer os.Unsetenv("APP_CONFIG")
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "serve"}))
+	assert.Equal(t, []string{xdg, other}, files)
+
+	require.EqualError(t, commands.Run(ctx, []string{"<exe>", "--config"}), "flag needs an argument: -config")
+
+	err = commands.Run(ctx, []string{"<exe>", "help"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Usage of <exe> [flags] [command]:")
+	assert.Contains(t, err.Error(), "-config string\n    \ta config file, that replaces the config files found, can be repeated (env \"APP_CONFIG\")")
+	assert.Contains(t, err.Error(), "Config files:\n  "+xdg+"\n  "+other+"\n")
+}
@@ -0,0 +1,177 @@
+package struct_flags
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FlagConstraints is implemented by a flags struct, or a nested flags struct, to declare
+// relationships between its flags. Flag names are relative to the struct declaring them.
+type FlagConstraints interface {
+	FlagConstraints() []FlagConstraint
+}
+
+type ConstraintKind int
+
+const (
+	// MutuallyExclusiveFlags allows at most one of the flags to be set
+	MutuallyExclusiveFlags ConstraintKind = iota + 1
+	// AtLeastOneFlag requires one or more of the flags to be set
+	AtLeastOneFlag
+	// ExactlyOneFlag requires one, and only one, of the flags to be set
+	ExactlyOneFlag
+	// FlagsRequiredTogether requires all of the flags to be set if any of them are
+	FlagsRequiredTogether
+	// FlagRequires requires the remaining flags to be set if the first flag is
+	FlagRequires
+)
+
+type FlagConstraint struct {
+	Kind  ConstraintKind
+	Flags []string
+}
+
+func MutuallyExclusive(flags ...string) FlagConstraint {
+	return FlagConstraint{Kind: MutuallyExclusiveFlags, Flags: flags}
+}
+
+func AtLeastOne(flags ...string) FlagConstraint {
+	return FlagConstraint{Kind: AtLeastOneFlag, Flags: flags}
+}
+
+func ExactlyOne(flags ...string) FlagConstraint {
+	return FlagConstraint{Kind: ExactlyOneFlag, Flags: flags}
+}
+
+func RequiredTogether(flags ...string) FlagConstraint {
+	return FlagConstraint{Kind: FlagsRequiredTogether, Flags: flags}
+}
+
+// Requires declares that when 'flag' is set, all of 'required' must be set too, eg. Requires("cert", "key")
+func Requires(flag string, required ...string) FlagConstraint {
+	return FlagConstraint{Kind: FlagRequires, Flags: append([]string{flag}, required...)}
+}
+
+func (c FlagConstraint) withPrefix(prefix string) FlagConstraint {
+	flags := make([]string, len(c.Flags))
+	for i, f := range c.Flags {
+		flags[i] = prefix + f
+	}
+	return FlagConstraint{Kind: c.Kind, Flags: flags}
+}
+
+// String describes the constraint as shown in usage, eg. 'exactly one of -file, -url'
+func (c FlagConstraint) String() string {
+	switch c.Kind {
+	case MutuallyExclusiveFlags:
+		return "at most one of " + joinFlagNames(c.Flags)
+	case AtLeastOneFlag:
+		return "at least one of " + joinFlagNames(c.Flags)
+	case ExactlyOneFlag:
+		return "exactly one of " + joinFlagNames(c.Flags)
+	case FlagsRequiredTogether:
+		return "all or none of " + joinFlagNames(c.Flags)
+	case FlagRequires:
+		return "-" + c.Flags[0] + " requires " + joinFlagNames(c.Flags[1:])
+	default:
+		return fmt.Sprintf("unknown constraint %d on %s", c.Kind, joinFlagNames(c.Flags))
+	}
+}
+
+// check returns an error naming the involved flags when the constraint is not satisfied
+func (c FlagConstraint) check(isSet func(flag string) bool) error {
+	var set, unset []string
+	for _, f := range c.Flags {
+		if isSet(f) {
+			set = append(set, f)
+		} else {
+			unset = append(unset, f)
+		}
+	}
+	switch c.Kind {
+	case MutuallyExclusiveFlags:
+		if len(set) > 1 {
+			return fmt.Errorf("flags %s cannot be used together", joinFlagNames(set))
+		}
+	case AtLeastOneFlag:
+		if len(set) == 0 {
+			return fmt.Errorf("at least one of the flags %s is required", joinFlagNames(c.Flags))
+		}
+	case ExactlyOneFlag:
+		if len(set) == 0 {
+			return fmt.Errorf("exactly one of the flags %s is required", joinFlagNames(c.Flags))
+		}
+		if len(set) > 1 {
+			return fmt.Errorf("exactly one of the flags %s is required, got %s", joinFlagNames(c.Flags), joinFlagNames(set))
+		}
+	case FlagsRequiredTogether:
+		if len(set) > 0 && len(unset) > 0 {
+			return fmt.Errorf("flags %s must be used together, missing %s", joinFlagNames(c.Flags), joinFlagNames(unset))
+		}
+	case FlagRequires:
+		if isSet(c.Flags[0]) {
+			var missing []string
+			for _, f := range c.Flags[1:] {
+				if !isSet(f) {
+					missing = append(missing, f)
+				}
+			}
+			if len(missing) > 0 {
+				return fmt.Errorf("flag -%s requires %s", c.Flags[0], joinFlagNames(missing))
+			}
+		}
+	}
+	return nil
+}
+
+func joinFlagNames(flags []string) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f
+	}
+	return strings.Join(names, ", ")
+}
+
+func printConstraints(w io.Writer, constraints []FlagConstraint) {
+	if len(constraints) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Flag constraints:")
+	for _, c := range constraints {
+		fmt.Fprintln(w, "  "+c.String())
+	}
+}
+
+// checkConstraintFlags panics if a constraint refers to a flag that was not collected
+func (c *flagCollector) checkConstraintFlags() {
+	for _, constraint := range c.constraints {
+		if len(constraint.Flags) == 0 {
+			panic(fmt.Sprintf("flag constraint of kind %d has no flags", constraint.Kind))
+		}
+		for _, f := range constraint.Flags {
+			if c.fs.Lookup(f) == nil {
+				panic("flag constraint '" + constraint.String() + "' refers to an unknown flag: -" + f)
+			}
+		}
+	}
+}
+
+// checkConstraints is called after parsing, a flag counts as set if it was provided on the command line, by the environment or in a config file
+func (c *flagCollector) checkConstraints() error {
+	if len(c.constraints) == 0 {
+		return nil
+	}
+	set := c.setFlags()
+	var errs []string
+	for _, constraint := range c.constraints {
+		if err := constraint.check(func(flag string) bool { return set[flag] }); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type sourceFlags struct {
+	File string `flag:"file"`
+	URL  string `flag:"url"`
+}
+
+func (sourceFlags) FlagConstraints() []FlagConstraint {
+	return []FlagConstraint{ExactlyOne("file", "url")}
+}
+
+type tlsFlags struct {
+	Cert   string      `flag:"cert"`
+	Key    string      `flag:"key"`
+	Source sourceFlags `flag:"source"`
+}
+
+func (tlsFlags) FlagConstraints() []FlagConstraint {
+	return []FlagConstraint{Requires("cert", "key")}
+}
+
+func TestFlagConstraints(t *testing.T) {
+
+	fs := NewFlagSet("", tlsFlags{})
+
+	var flags tlsFlags
+	_, err := fs.UnmarshalFlags([]string{"--source.file=a"}, &flags)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", flags.Source.File)
+
+	_, err = fs.UnmarshalFlags([]string{}, &flags)
+	assert.EqualError(t, err, "exactly one of the flags -source.file, -source.url is required")
+
+	_, err = fs.UnmarshalFlags([]string{"--source.file=a", "--source.url=b"}, &flags)
+	assert.EqualError(t, err, "exactly one of the flags -source.file, -source.url is required, got -source.file, -source.url")
+
+	_, err = fs.UnmarshalFlags([]string{"--source.url=b", "--cert=c"}, &flags)
+	assert.EqualError(t, err, "flag -cert requires -key")
+
+	_, err = fs.UnmarshalFlags([]string{"--source.url=b", "--cert=c", "--key=k"}, &flags)
+	assert.NoError(t, err)
+}
+
+func TestFlagConstraint_check(t *testing.T) {
+
+	set := func(flags ...string) func(string) bool {
+		return func(flag string) bool {
+			for _, f := range flags {
+				if f == flag {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	assert.NoError(t, MutuallyExclusive("a", "b").check(set()))
+	assert.EqualError(t, MutuallyExclusive("a", "b", "c").check(set("a", "c")), "flags -a, -c cannot be used together")
+	assert.EqualError(t, AtLeastOne("a", "b").check(set()), "at least one of the flags -a, -b is required")
+	assert.NoError(t, AtLeastOne("a", "b").check(set("a", "b")))
+	assert.EqualError(t, RequiredTogether("a", "b", "c").check(set("b")), "flags -a, -b, -c must be used together, missing -a, -c")
+	assert.NoError(t, RequiredTogether("a", "b").check(set()))
+}
+
+func TestFlagConstraints_UnknownFlag(t *testing.T) {
+	require.Panics(t, func() {
+		_, _ = NewFlagSet("", constrainedByUnknownFlag{}).UnmarshalFlags([]string{}, &constrainedByUnknownFlag{})
+	})
+}
+
+func TestFlagConstraints_Command(t *testing.T) {
+	command := NewCommand("cmd", tlsFlags{}, "", func(_ context.Context, _ tlsFlags) error {
+		return nil
+	})
+	require.EqualError(t, Commands{command}.Run(context.TODO(), []string{"<exe>", "cmd"}), "exactly one of the flags -source.file, -source.url is required")
+}
+
+type constrainedByUnknownFlag struct {
+	File string `flag:"file"`
+}
+
+func (constrainedByUnknownFlag) FlagConstraints() []FlagConstraint {
+	return []FlagConstraint{MutuallyExclusive("file", "missing")}
+}
@@ -0,0 +1,50 @@
+package struct_flags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// applyDefaultTag sets a zero value from the field's `default:"..."` tag, a value in the prefilled flags struct takes precedence.
+// The tag is expanded by expandDefault and parsed by 'set'.
+func (fi flagInfo) applyDefaultTag(value reflect.Value, env envLayer, set func(string) error) bool {
+	if fi.defaultTag == "" || !reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface()) {
+		return false
+	}
+	s := expandDefault(fi.defaultTag, env)
+	if err := set(s); err != nil {
+		panic(flagConfigError{err: "invalid default \"" + s + "\" for flag -" + fi.name + ": " + numError(err).Error(), v: value})
+	}
+	return true
+}
+
+// expandDefault replaces ${var} or $var in a default tag with the environment variable, from 'env' or the process environment, or one of:
+//
+//	HOME             the user's home directory
+//	USER_CACHE_DIR   the user's cache directory, eg. $HOME/.cache
+//	USER_CONFIG_DIR  the user's config directory, eg. $HOME/.config
+//	EXECUTABLE       the name of the executable
+func expandDefault(s string, env envLayer) string {
+	return os.Expand(s, func(name string) string {
+		var dir string
+		var err error
+		switch name {
+		case "HOME":
+			dir, err = os.UserHomeDir()
+		case "USER_CACHE_DIR":
+			dir, err = os.UserCacheDir()
+		case "USER_CONFIG_DIR":
+			dir, err = os.UserConfigDir()
+		case "EXECUTABLE":
+			return filepath.Base(os.Args[0])
+		default:
+			value, _ := env.lookup(name)
+			return value
+		}
+		if err != nil {
+			return ""
+		}
+		return dir
+	})
+}
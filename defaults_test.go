@@ -0,0 +1,60 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDefaultTag(t *testing.T) {
+
+	type Shared struct {
+		Timeout time.Duration `flag:"timeout" default:"30s"`
+	}
+
+	type Flags struct {
+		Cache  string   `flag:"cache" default:"$HOME/.cache/${EXECUTABLE}"`
+		Port   int      `flag:"port" default:"8080"`
+		Hosts  []string `flag:"hosts" default:"a,b"`
+		Shared Shared   `flag:"shared"`
+		Target string   `flag:"[target]" default:"${TEST_DEFAULT_TARGET}"`
+	}
+
+	require.NoError(t, os.Setenv("TEST_DEFAULT_TARGET", "local"))
+	defer os.Unsetenv("TEST_DEFAULT_TARGET")
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	var result Flags
+	command := NewCommand("cmd [target]", Flags{Port: 9090}, "", func(_ context.Context, f Flags) error {
+		result = f
+		return nil
+	})
+
+	require.NoError(t, Commands{command}.Run(context.TODO(), []string{"<exe>", "cmd"}))
+	assert.Equal(t, Flags{
+		Cache:  filepath.Join(home, ".cache", filepath.Base(os.Args[0])),
+		Port:   9090,
+		Hosts:  []string{"a", "b"},
+		Shared: Shared{Timeout: 30 * time.Second},
+		Target: "local",
+	}, result)
+
+	require.NoError(t, Commands{command}.Run(context.TODO(), []string{"<exe>", "cmd", "--hosts=c", "--shared.timeout=1m", "remote"}))
+	assert.Equal(t, []string{"c"}, result.Hosts)
+	assert.Equal(t, time.Minute, result.Shared.Timeout)
+	assert.Equal(t, "remote", result.Target)
+
+	type Invalid struct {
+		Port int `flag:"port" default:"http"`
+	}
+
+	require.Panics(t, func() {
+		_, _ = NewFlagSet("", Invalid{}).UnmarshalFlags([]string{}, &Invalid{})
+	})
+}
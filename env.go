@@ -0,0 +1,240 @@
+package struct_flags
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// envNames returns the environment variables of a flag, eg. `env:"NEW_NAME,OLD_NAME"`, in order of precedence
+func (fi flagInfo) envNames() []string {
+	var names []string
+	for _, name := range strings.Split(fi.env, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// autoEnvTag is the env tag for a name derived from the flag name
+const autoEnvTag = "auto"
+
+// resolveEnv replaces `env:"auto"` with the name derived from the flag name, with Options.AutoEnv a field without an env tag gets one too
+func (c *flagCollector) resolveEnv(info *flagInfo) string {
+	if info.positional != "" {
+		return info.env
+	}
+	derived := envName(c.envPrefix, info.name)
+	if info.env == "" {
+		if c.autoEnv {
+			return derived
+		}
+		return ""
+	}
+	names := info.envNames()
+	for i, name := range names {
+		if name == autoEnvTag {
+			names[i] = derived
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// envLayer are the environment variables set by argfiles, they are read before the process environment
+type envLayer map[string]string
+
+var envLayerKey = contextKey{value: 13}
+
+func getEnvLayer(ctx context.Context) envLayer {
+	env, _ := ctx.Value(envLayerKey).(envLayer)
+	return env
+}
+
+func withEnvLayer(ctx context.Context, env envLayer) context.Context {
+	return context.WithValue(ctx, envLayerKey, env)
+}
+
+func (e envLayer) lookup(name string) (string, bool) {
+	if value, ok := e[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// expand replaces ${var} or $var like os.ExpandEnv
+func (e envLayer) expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		value, _ := e.lookup(name)
+		return value
+	})
+}
+
+func (e envLayer) with(name, value string) envLayer {
+	env := envLayer{name: value}
+	for k, v := range e {
+		if k != name {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// LookupEnv returns an environment variable, that can be set by an argfile
+func LookupEnv(ctx context.Context, name string) (string, bool) {
+	return getEnvLayer(ctx).lookup(name)
+}
+
+// Environ returns the process environment with the variables set by argfiles, eg. for exec.Cmd.Env
+func Environ(ctx context.Context) []string {
+	env := getEnvLayer(ctx)
+	var environ []string
+	for _, kv := range os.Environ() {
+		if _, ok := env[strings.SplitN(kv, "=", 2)[0]]; !ok {
+			environ = append(environ, kv)
+		}
+	}
+	for _, name := range sortedEnvNames(env) {
+		environ = append(environ, name+"="+env[name])
+	}
+	return environ
+}
+
+func sortedEnvNames(env envLayer) []string {
+	var names []string
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envName joins and converts names to an environment variable name, eg. 'MY_UTIL_NESTED_STRING1' for 'my-util' and 'nested.string1'
+func envName(names ...string) string {
+	var parts []string
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		parts = append(parts, strings.Map(func(r rune) rune {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			if r >= 'a' && r <= 'z' {
+				return r - 'a' + 'A'
+			}
+			return '_'
+		}, name))
+	}
+	return strings.Join(parts, "_")
+}
+
+// envPrefix is Options.EnvPrefix, followed by the command path if Options.EnvCommandScope is set
+func (s flagSet) envPrefix() string {
+	if s.options.EnvCommandScope {
+		return envName(append([]string{s.options.EnvPrefix}, s.path...)...)
+	}
+	return envName(s.options.EnvPrefix)
+}
+
+const (
+	envFileOption = "envfile"
+	envFileSuffix = "_FILE"
+)
+
+// hasFlagOption reports whether the options of a flag tag, eg. `flag:"name,option"`, include 'option'
+func hasFlagOption(options []string, option string) bool {
+	for _, o := range options {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecret reports whether the flag can be read from a <NAME>_FILE, its value is not shown in the usage or errors
+func (fi flagInfo) isSecret() bool {
+	return fi.envFile && fi.env != "" && fi.positional == ""
+}
+
+// isSecretField reports whether the flag of a field, with the environment variables resolved as by flagCollector, is a secret
+func isSecretField(options Options, field reflect.StructField, prefix string) bool {
+	info, ok := readFieldFlagInfo(field, prefix)
+	if !ok {
+		return false
+	}
+	c := flagCollector{autoEnv: options.AutoEnv, envPrefix: envName(options.EnvPrefix), envFiles: options.EnvFiles}
+	info.env = c.resolveEnv(info)
+	info.envFile = info.envFile || c.envFiles
+	return info.isSecret()
+}
+
+// readEnv sets the flag from the first of its environment variables that is set, in 'env' or the process environment,
+// using the same parser as the command line. The value is shown as the default in usage,
+// unless the flag is a secret, see isSecret. It returns the name of the variable that was read.
+func (fi flagInfo) readEnv(f *flag.Flag, value reflect.Value, env envLayer) (string, error) {
+	for _, name := range fi.envNames() {
+		envValue, ok := env.lookup(name)
+		fromFile := false
+		if fi.envFile {
+			if filename, isSet := env.lookup(name + envFileSuffix); isSet {
+				if ok {
+					return "", fmt.Errorf("both env %s and %s%s are set (flag -%s)", name, name, envFileSuffix, fi.name)
+				}
+				data, err := ioutil.ReadFile(filename)
+				if err != nil {
+					return "", fmt.Errorf("could not read env %s%s (flag -%s): %s", name, envFileSuffix, fi.name, err.Error())
+				}
+				name, envValue, ok, fromFile = name+envFileSuffix, strings.TrimSpace(string(data)), true, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := setFlagValue(f, value, envValue); err != nil {
+			if fromFile {
+				return "", fmt.Errorf("invalid value in the file of env %s (flag -%s): %s", name, fi.name, numError(err).Error())
+			}
+			if fi.isSecret() {
+				return "", fmt.Errorf("invalid value for env %s (flag -%s): %s", name, fi.name, numError(err).Error())
+			}
+			return "", fmt.Errorf("invalid value \"%s\" for env %s (flag -%s): %s", envValue, name, fi.name, numError(err).Error())
+		}
+		if !fi.isSecret() {
+			f.DefValue = f.Value.String()
+		}
+		if r, ok := f.Value.(resettable); ok {
+			// the command line replaces the value from the environment
+			r.reset()
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// checkEnv is called after parsing, an invalid environment variable is an error unless its flag was set on the command line
+func (c *flagCollector) checkEnv(lenient bool) error {
+	if lenient {
+		return nil
+	}
+	set := map[string]bool{}
+	c.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var errs []string
+	for _, f := range c.flags {
+		if f.envErr != nil && !set[f.name] {
+			errs = append(errs, f.envErr.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
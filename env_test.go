@@ -0,0 +1,236 @@
+package struct_flags
+
+import (
+	"context"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlagSet_StrictEnv(t *testing.T) {
+
+	type Flags struct {
+		Port int  `flag:"port" env:"TEST_STRICT_PORT"`
+		Bool bool `flag:"bool" env:"TEST_STRICT_BOOL"`
+	}
+
+	require.NoError(t, os.Setenv("TEST_STRICT_PORT", "abc"))
+	defer os.Unsetenv("TEST_STRICT_PORT")
+
+	fs := NewFlagSet("", Flags{Port: 80})
+	flags := Flags{}
+	_, err := fs.UnmarshalFlags([]string{}, &flags)
+	assert.EqualError(t, err, "invalid value \"abc\" for env TEST_STRICT_PORT (flag -port): parse error")
+
+	// the command line takes precedence over an invalid environment variable
+	_, err = fs.UnmarshalFlags([]string{"--port=81"}, &flags)
+	assert.NoError(t, err)
+	assert.Equal(t, 81, flags.Port)
+
+	require.NoError(t, os.Setenv("TEST_STRICT_BOOL", "maybe"))
+	defer os.Unsetenv("TEST_STRICT_BOOL")
+
+	_, err = fs.UnmarshalFlags([]string{}, &flags)
+	assert.EqualError(t, err, "invalid value \"abc\" for env TEST_STRICT_PORT (flag -port): parse error\ninvalid value \"maybe\" for env TEST_STRICT_BOOL (flag -bool): parse error")
+
+	var result Flags
+	command := NewCommand("cmd", Flags{Port: 80}, "", func(_ context.Context, f Flags) error {
+		result = f
+		return nil
+	})
+	ctx := WithOptions(context.TODO(), Options{LenientEnv: true})
+	require.NoError(t, Commands{command}.Run(ctx, []string{"<exe>", "cmd"}))
+	assert.Equal(t, Flags{Port: 80}, result)
+}
+
+func TestFlagSet_EnvTypes(t *testing.T) {
+
+	type Nested struct {
+		Timeout time.Duration `flag:"timeout" env:"TEST_TYPES_TIMEOUT"`
+	}
+
+	type Flags struct {
+		Hosts  []string          `flag:"hosts" env:"TEST_TYPES_HOSTS"`
+		Ports  []int             `flag:"ports" env:"TEST_TYPES_PORTS"`
+		Labels map[string]string `flag:"labels" env:"TEST_TYPES_LABELS"`
+		Name   string            `flag:"name" env:"TEST_TYPES_NEW_NAME,TEST_TYPES_OLD_NAME"`
+		Nested Nested            `flag:"nested"`
+	}
+
+	env := map[string]string{
+		"TEST_TYPES_HOSTS":    "a,b,c",
+		"TEST_TYPES_PORTS":    "80,443",
+		"TEST_TYPES_LABELS":   "k=v,k2=v2",
+		"TEST_TYPES_OLD_NAME": "old",
+		"TEST_TYPES_TIMEOUT":  "1m",
+	}
+	for k, v := range env {
+		require.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+
+	fs := NewFlagSet("", Flags{Hosts: []string{"default"}})
+	var flags Flags
+	_, err := fs.UnmarshalFlags([]string{}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, Flags{
+		Hosts:  []string{"a", "b", "c"},
+		Ports:  []int{80, 443},
+		Labels: map[string]string{"k": "v", "k2": "v2"},
+		Name:   "old",
+		Nested: Nested{Timeout: time.Minute},
+	}, flags)
+
+	require.NoError(t, os.Setenv("TEST_TYPES_NEW_NAME", "new"))
+	defer os.Unsetenv("TEST_TYPES_NEW_NAME")
+
+	// the command line replaces values from the environment
+	flags = Flags{}
+	_, err = fs.UnmarshalFlags([]string{"--hosts=d", "--hosts=e", "--labels=x=y"}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "e"}, flags.Hosts)
+	assert.Equal(t, map[string]string{"x": "y"}, flags.Labels)
+	assert.Equal(t, "new", flags.Name)
+
+	require.NoError(t, os.Setenv("TEST_TYPES_PORTS", "80,http"))
+	defer os.Unsetenv("TEST_TYPES_PORTS")
+	_, err = fs.UnmarshalFlags([]string{}, &flags)
+	assert.EqualError(t, err, "invalid value \"80,http\" for env TEST_TYPES_PORTS (flag -ports): parse error")
+}
+
+func TestAutoEnv(t *testing.T) {
+
+	type Nested struct {
+		String1 string `flag:"string1"`
+	}
+
+	type Flags struct {
+		String string `flag:"string" env:"auto"`
+		Int    int    `flag:"int"`
+		Nested Nested `flag:"nested"`
+	}
+
+	assert.Equal(t, "MY_UTIL_NESTED_STRING1", envName("my-util", "nested.string1"))
+
+	env := map[string]string{
+		"MY_UTIL_STRING":                    "a",
+		"MY_UTIL_INT":                       "1",
+		"MY_UTIL_PRINT_ARGS_NESTED_STRING1": "b",
+	}
+	for k, v := range env {
+		require.NoError(t, os.Setenv(k, v))
+		defer os.Unsetenv(k)
+	}
+
+	var flags Flags
+	_, err := NewFlagSetWithOptions("", Flags{}, Options{EnvPrefix: "MY_UTIL"}).UnmarshalFlags([]string{}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, Flags{String: "a"}, flags)
+
+	var result Flags
+	command := NewCommand("print-args", Flags{}, "", func(_ context.Context, f Flags) error {
+		result = f
+		return nil
+	})
+	ctx := WithOptions(context.TODO(), Options{EnvPrefix: "MY_UTIL", AutoEnv: true, EnvCommandScope: true})
+	require.NoError(t, Commands{command}.Run(ctx, []string{"<exe>", "print-args"}))
+	assert.Equal(t, Flags{Nested: Nested{String1: "b"}}, result)
+}
+
+func TestEnvFile(t *testing.T) {
+
+	type Flags struct {
+		Password string `flag:"password,envfile" env:"TEST_DB_PASSWORD" validate:"min=8"`
+		User     string `flag:"user" env:"TEST_DB_USER"`
+	}
+
+	secret, err := ioutil.TempFile("", t.Name())
+	require.NoError(t, err)
+	defer os.Remove(secret.Name())
+	_, err = secret.WriteString("s3cret\n")
+	require.NoError(t, err)
+	require.NoError(t, secret.Close())
+
+	require.NoError(t, os.Setenv("TEST_DB_PASSWORD_FILE", secret.Name()))
+	defer os.Unsetenv("TEST_DB_PASSWORD_FILE")
+
+	var result Flags
+	command := NewCommand("cmd", Flags{}, "", func(_ context.Context, f Flags) error {
+		result = f
+		return nil
+	})
+	commands := Commands{command}
+
+	err = commands.Run(context.TODO(), []string{"<exe>", "cmd"})
+	require.EqualError(t, err, "invalid value for flag -password (from env TEST_DB_PASSWORD_FILE): validation failed for rule 'min=8'")
+	assert.NotContains(t, err.Error(), "s3cret")
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd", "--password=password"}))
+	assert.Equal(t, "password", result.Password)
+
+	require.NoError(t, os.Setenv("TEST_DB_PASSWORD", "other"))
+	defer os.Unsetenv("TEST_DB_PASSWORD")
+	require.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd"}), "both env TEST_DB_PASSWORD and TEST_DB_PASSWORD_FILE are set (flag -password)")
+	require.NoError(t, os.Unsetenv("TEST_DB_PASSWORD"))
+
+	// opted in for every field
+	require.NoError(t, os.Setenv("TEST_DB_USER_FILE", secret.Name()))
+	defer os.Unsetenv("TEST_DB_USER_FILE")
+	ctx := WithOptions(context.TODO(), Options{EnvFiles: true})
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "cmd", "--password=password"}))
+	assert.Equal(t, Flags{Password: "password", User: "s3cret"}, result)
+
+	require.NoError(t, os.Setenv("TEST_DB_PASSWORD_FILE", secret.Name()+".missing"))
+	err = commands.Run(context.TODO(), []string{"<exe>", "cmd"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not read env TEST_DB_PASSWORD_FILE (flag -password): open ")
+}
+
+func TestEnvFile_Secrets(t *testing.T) {
+
+	type Flags struct {
+		Password string `flag:"password" validate:"min=8"`
+	}
+
+	secret, err := ioutil.TempFile("", t.Name())
+	require.NoError(t, err)
+	defer os.Remove(secret.Name())
+	_, err = secret.WriteString("s3cret\n")
+	require.NoError(t, err)
+	require.NoError(t, secret.Close())
+
+	require.NoError(t, os.Setenv("APP_PASSWORD_FILE", secret.Name()))
+	defer os.Unsetenv("APP_PASSWORD_FILE")
+
+	// the env is derived by Options.AutoEnv, without an env tag
+	commands := Commands{NewCommand("cmd", Flags{}, "", func(_ context.Context, f Flags) error {
+		return nil
+	})}
+	ctx := WithOptions(context.TODO(), Options{EnvPrefix: "app", AutoEnv: true, EnvFiles: true})
+	err = commands.Run(ctx, []string{"<exe>", "cmd"})
+	require.EqualError(t, err, "invalid value for flag -password (from env APP_PASSWORD_FILE): validation failed for rule 'min=8'")
+
+	// a secret from the variable itself is not shown either
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	value := reflect.New(reflect.TypeOf(0)).Elem()
+	require.True(t, registerFlag(fs, "pin", "", value))
+	info := flagInfo{name: "pin", env: "TEST_PIN", envFile: true}
+
+	name, err := info.readEnv(fs.Lookup("pin"), value, envLayer{"TEST_PIN": "1234"})
+	require.NoError(t, err)
+	assert.Equal(t, "TEST_PIN", name)
+	assert.Equal(t, 1234, value.Interface())
+	assert.Equal(t, "0", fs.Lookup("pin").DefValue)
+
+	_, err = info.readEnv(fs.Lookup("pin"), value, envLayer{"TEST_PIN": "12a4"})
+	require.EqualError(t, err, "invalid value for env TEST_PIN (flag -pin): parse error")
+
+	info.envFile = false
+	_, err = info.readEnv(fs.Lookup("pin"), value, envLayer{"TEST_PIN": "12a4"})
+	require.EqualError(t, err, "invalid value \"12a4\" for env TEST_PIN (flag -pin): parse error")
+}
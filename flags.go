@@ -1,8 +1,8 @@
 package struct_flags
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -11,7 +11,6 @@ import (
 	"os"
 	"reflect"
 	"runtime"
-	"strconv"
 	"strings"
 )
 
@@ -35,10 +34,31 @@ type CommandGroup interface {
 	Commands() Commands
 }
 
+// CommandGroupFlags is optionally implemented by a CommandGroup with flags, which are parsed from the arguments
+// between the group's name and the subcommand. See NewCommandGroupWithFlags and GetGroupFlags.
+type CommandGroupFlags interface {
+	// DefaultFlags is a prefilled instance of a struct type that flag parsing will populate
+	DefaultFlags() (flags interface{})
+}
+
+// CommandAliases is optionally implemented by an ICommand that can be selected by other names.
+// NewCommand and NewCommandGroup read aliases from the name, eg. "list|ls [dir]".
+type CommandAliases interface {
+	Aliases() []string
+}
+
+// ArgFile is the object of an @argfile, in a .json, .yaml, .yml or .toml file. A file with another extension that is not
+// a JSON object is a response file, with the arguments separated by whitespace, eg. one per line, '#' comments and shell-like quoting.
 type ArgFile struct {
-	Command []string `json:"command"`
-	Args    []string `json:"args"`
-	Env     []string `json:"env"`
+	// Include are the argfiles merged before this one, in order. A relative path is relative to the directory of this file.
+	Include []string `json:"include" yaml:"include" toml:"include"`
+	Command []string `json:"command" yaml:"command" toml:"command"`
+	Args    []string `json:"args" yaml:"args" toml:"args"`
+	Env     []string `json:"env" yaml:"env" toml:"env"`
+	// Profiles are selected by Options.Profiles
+	Profiles map[string]ArgFileProfile `json:"profiles" yaml:"profiles" toml:"profiles"`
+	// sources are the sources of Args, that can be in included files
+	sources []Source
 }
 
 func NewCommand(name string, defaultFlagsStruct interface{}, usage string, executeFn interface{}) Command {
@@ -77,6 +97,22 @@ func NewCommand(name string, defaultFlagsStruct interface{}, usage string, execu
 	return c
 }
 
+// Default marks a command, or command group, to be run when its Commands list is run without a command name.
+// An explicit "help" still prints the usage.
+func Default(c ICommand) ICommand {
+	switch t := c.(type) {
+	case Command:
+		return defaultCommand{Command: t}
+	case CommandGroup:
+		if _, ok := t.(CommandGroupFlags); ok {
+			return defaultCommandGroupWithFlags{defaultCommandGroup{CommandGroup: t}}
+		}
+		return defaultCommandGroup{CommandGroup: t}
+	default:
+		panic(reflect.TypeOf(c).String() + " is not a Command or CommandGroup")
+	}
+}
+
 func NewCommandGroup(name, usage string, commands ...ICommand) CommandGroup {
 	return commandGroup{
 		name:     name,
@@ -85,6 +121,19 @@ func NewCommandGroup(name, usage string, commands ...ICommand) CommandGroup {
 	}
 }
 
+// NewCommandGroupWithFlags creates a group with flags, eg. 'my_util cluster --context=prod nodes list'
+func NewCommandGroupWithFlags(name, usage string, defaultFlagsStruct interface{}, commands ...ICommand) CommandGroup {
+	if defaultFlagsStruct == nil {
+		panic("'defaultFlagsStruct' must be provided")
+	}
+	return commandGroup{
+		name:         name,
+		usage:        usage,
+		defaultFlags: defaultFlagsStruct,
+		commands:     commands,
+	}
+}
+
 var ValidateStructFields = defaultValidateStructFields
 
 type usage struct {
@@ -141,139 +190,329 @@ func withRemainingArgs(ctx context.Context, remaining []string) context.Context
 	return context.WithValue(ctx, remainingArgsKey, remaining)
 }
 
+var groupFlagsKey = contextKey{value: 5}
+
+// GetGroupFlags sets 'flags', a pointer to the flags type of a CommandGroup, to the flags parsed for the nearest group of that type
+func GetGroupFlags(ctx context.Context, flags interface{}) bool {
+	values, _ := ctx.Value(groupFlagsKey).([]interface{})
+	for i := len(values) - 1; i >= 0; i-- {
+		if assignFlags(flags, values[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// assignFlags sets 'flags', a pointer to a flags struct, to 'value' if it has the same type
+func assignFlags(flags interface{}, value interface{}) bool {
+	target := reflect.ValueOf(flags)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		panic("expected a pointer to a flags struct, got: " + target.String())
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || v.Type() != target.Elem().Type() {
+		return false
+	}
+	target.Elem().Set(v)
+	return true
+}
+
+func withGroupFlags(ctx context.Context, flags interface{}) context.Context {
+	values, _ := ctx.Value(groupFlagsKey).([]interface{})
+	return context.WithValue(ctx, groupFlagsKey, append(append([]interface{}{}, values...), flags))
+}
+
 func (cs Commands) Run(ctx context.Context, args []string) error {
+	ctx, args, err := cs.loadConfig(ctx, args)
+	if err != nil {
+		return err
+	}
+	ctx, args, err = expandArgFiles(ctx, args)
+	if err != nil {
+		return err
+	}
+	ctx, args, err = cs.parseGlobalFlags(ctx, args)
+	if err != nil {
+		return err
+	}
+	ctx, args, err = cs.parseRootFlags(ctx, args)
+	if err != nil {
+		return err
+	}
 	parentCommands := getParentCommands(ctx)
 	minArgs := len(parentCommands) + 2
 	if len(args) < minArgs {
-		return cs.usage(args)
-	}
-	currentCommandName := strings.ToLower(args[len(parentCommands)+1])
-
-	// Argfile requested
-	if strings.HasPrefix(currentCommandName, "@") && getArgFile(ctx) == nil {
-		mergedArgs, ctx, err := mergeArgsFileArgs(currentCommandName[1:], ctx, args)
-		if err != nil {
-			return err
+		if c := cs.defaultCommand(); c != nil {
+			return cs.Run(ctx, append(append([]string{}, args...), c.Name()))
 		}
-		return cs.Run(ctx, mergedArgs)
+		return cs.usage(ctx, args)
 	}
+	currentCommandName := strings.ToLower(args[len(parentCommands)+1])
 
 	var command Command
-	for _, c := range cs {
-		if strings.ToLower(c.Name()) == currentCommandName {
-			switch t := c.(type) {
-			case Command:
-				command = t
-				break
-			case CommandGroup:
-				return t.Commands().Run(withParentCommands(ctx, append(parentCommands, currentCommandName)), args)
-			}
-		}
+	found, err := cs.find(ctx, args, currentCommandName)
+	if err != nil {
+		return err
+	}
+	switch t := found.(type) {
+	case Command:
+		command = t
+	case CommandGroup:
+		return runCommandGroup(withParentCommands(ctx, append(parentCommands, strings.ToLower(t.Name()))), t, args)
 	}
 	if command == nil || command.Name() == "" {
-		return cs.usage(args)
+		if isHelpArg(currentCommandName) {
+			return cs.usage(ctx, args)
+		}
+		return cs.unknownCommand(ctx, args, args[len(parentCommands)+1])
+	}
+	if err := getProfile(ctx).check(); err != nil {
+		return err
 	}
 	flags := command.DefaultFlags()
-	remaining, arg, err := parseCommandFlags(flags, command.PositionalArgs(), args[minArgs:])
+	// the command path scopes derived environment variable names, see Options.EnvCommandScope
+	commandCtx := withParentCommands(ctx, append(append([]string{}, parentCommands...), strings.ToLower(command.Name())))
+	remaining, arg, sources, err := parseCommandFlags(commandCtx, flags, command.PositionalArgs(), args[minArgs:])
 	if err != nil {
 		return err
 	}
 
-	if err := command.Execute(withRemainingArgs(ctx, remaining), arg); err != nil {
-		switch verr := err.(type) {
-		case validator.ValidationErrors:
-			var errs []string
-			for _, ferr := range verr {
-				field, ok := getStructFieldForError(ferr, arg)
-				if !ok {
-					errs = append(errs, validator.ValidationErrors{ferr}.Error())
-					continue
-				}
-				flagName := field.Tag.Get("flag")
-				rule := ferr.Tag()
-				if ferr.Param() != "" {
-					rule += "=" + ferr.Param()
-				}
-				var message string
-				// Write a similar message to 'flags', eg. 'invalid value "bad" for flag -int: parse error'
-				if argName := readPositionalArg(flagName); argName != "" {
-					message = fmt.Sprintf("invalid value \"%s\" for argument [%s]: validation failed for rule '%s'", fmt.Sprint(ferr.Value()), argName, rule)
-				} else {
-					message = fmt.Sprintf("invalid value \"%s\" for flag -%s: validation failed for rule '%s'", fmt.Sprint(ferr.Value()), flagName, rule)
-				}
-				errs = append(errs, message)
-			}
-			err = errors.New(strings.Join(errs, "\n"))
-			// TODO implement flags.PrintUsage()
-			_, _, _ = parseCommandFlags(flags, command.PositionalArgs(), []string{"--help"})
-			return err
+	if err := command.Execute(withSources(withRemainingArgs(ctx, remaining), sources), arg); err != nil {
+		if verr, ok := err.(validator.ValidationErrors); ok {
+			printCommandUsage(commandCtx, flags, command.PositionalArgs())
+			return describeValidationErrors(ctx, verr, arg, command.PositionalArgs(), sources)
 		}
 		return err
 	}
 	return nil
 }
 
-func mergeArgsFileArgs(filename string, ctx context.Context, args []string) ([]string, context.Context, error) {
-	data, err := ioutil.ReadFile(filename)
+// runCommandGroup parses the group's flags, if it has any, from the arguments before the subcommand and runs the subcommand
+func runCommandGroup(ctx context.Context, group CommandGroup, args []string) error {
+	g, ok := group.(CommandGroupFlags)
+	if !ok || g.DefaultFlags() == nil {
+		return group.Commands().Run(ctx, args)
+	}
+	argsBeforeFlags := len(getParentCommands(ctx)) + 1
+	remaining, flags, err := parseLeadingFlags(ctx, g.DefaultFlags(), args[argsBeforeFlags:])
+	if err == flag.ErrHelp {
+		return group.Commands().usage(ctx, args)
+	}
 	if err != nil {
-		return nil, ctx, fmt.Errorf("could not open @argfile, err: %s", err.Error())
+		return err
 	}
-	var argFile ArgFile
-	if err := json.Unmarshal(data, &argFile); err != nil {
-		return nil, ctx, fmt.Errorf("could not read @argfile, err: %s", err.Error())
+	args = append(append([]string{}, args[:argsBeforeFlags]...), remaining...)
+	return group.Commands().Run(withGroupFlags(ctx, flags), args)
+}
+
+// parseLeadingFlags parses and validates the flags of a group or the root, which end at the first argument that is not a flag
+func parseLeadingFlags(ctx context.Context, defaultFlags interface{}, args []string) ([]string, interface{}, error) {
+	remaining, flags, sources, err := parseCommandFlags(ctx, defaultFlags, nil, args)
+	if err != nil {
+		return nil, nil, err
 	}
-	ctx = withArgFile(ctx, &argFile)
-	for _, env := range argFile.Env {
-		kv := strings.SplitN(env, "=", 2)
-		if err := os.Setenv(kv[0], os.ExpandEnv(kv[1])); err != nil {
-			return nil, ctx, fmt.Errorf("failed to apply environment variable %s from @argfile", err.Error())
+	if ValidateStructFields != nil {
+		if err := ValidateStructFields(flags); err != nil {
+			if verr, ok := err.(validator.ValidationErrors); ok {
+				printCommandUsage(ctx, defaultFlags, nil)
+				return nil, nil, describeValidationErrors(ctx, verr, flags, nil, sources)
+			}
+			return nil, nil, err
 		}
 	}
+	return remaining, flags, nil
+}
 
-	var mergedArgs []string
-	parentCommands := getParentCommands(ctx)
-	// "<exe> command* @argsfile.txt args..." to "<exe> command*"
-	mergedArgs = append(mergedArgs, args[:len(parentCommands)+1]...)
-	// "<exe> command*"                       to "<exe> command* argFileCommands... argFileArgs..."
-	mergedArgs = append(mergedArgs, argFile.Command...)
-	fileArgs := append([]string{}, argFile.Args...)
-	for i, arg := range fileArgs {
-		fileArgs[i] = os.ExpandEnv(arg)
+var rootFlagsKey = contextKey{value: 7}
+
+// GetRootFlags sets 'flags', a pointer to the type of Options.RootFlags, to the parsed root flags
+func GetRootFlags(ctx context.Context, flags interface{}) bool {
+	value := ctx.Value(rootFlagsKey)
+	if value == nil {
+		return false
+	}
+	return assignFlags(flags, value)
+}
+
+// parseRootFlags parses Options.RootFlags from the arguments before the first command name
+func (cs Commands) parseRootFlags(ctx context.Context, args []string) (context.Context, []string, error) {
+	defaults := getOptions(ctx).RootFlags
+	if defaults == nil || len(getParentCommands(ctx)) > 0 || ctx.Value(rootFlagsKey) != nil || len(args) == 0 {
+		return ctx, args, nil
+	}
+	remaining, flags, err := parseLeadingFlags(ctx, defaults, args[1:])
+	if err == flag.ErrHelp {
+		return ctx, args, cs.usage(ctx, args)
+	}
+	if err != nil {
+		return ctx, args, err
+	}
+	return context.WithValue(ctx, rootFlagsKey, flags), append([]string{args[0]}, remaining...), nil
+}
+
+// describeValidationErrors names the flag or positional argument of each validation error, and the source of its value
+func describeValidationErrors(ctx context.Context, verr validator.ValidationErrors, arg interface{}, positionalArgs []string, sources Sources) error {
+	var errs []string
+	for _, ferr := range verr {
+		field, ok := getStructFieldForError(ferr, arg)
+		if !ok {
+			errs = append(errs, validator.ValidationErrors{ferr}.Error())
+			continue
+		}
+		prefix := getFlagPrefixForError(ferr, arg)
+		flagName := strings.Split(field.Tag.Get("flag"), ",")[0]
+		rule := ferr.Tag()
+		if ferr.Param() != "" {
+			rule += "=" + ferr.Param()
+		}
+		var message string
+		// Write a similar message to 'flags', eg. 'invalid value "bad" for flag -int: parse error'
+		if argName := readPositionalArg(flagName); argName != "" {
+			message = fmt.Sprintf("invalid value \"%s\" for argument %s%s: validation failed for rule '%s'", fmt.Sprint(ferr.Value()), describePositionalArg(positionalArgs, argName), describeSource(sources, prefix+argName), rule)
+		} else if isSecretField(getOptions(ctx), field, prefix) {
+			message = fmt.Sprintf("invalid value for flag -%s%s: validation failed for rule '%s'", prefix+flagName, describeSource(sources, prefix+flagName), rule)
+		} else {
+			message = fmt.Sprintf("invalid value \"%s\" for flag -%s%s: validation failed for rule '%s'", fmt.Sprint(ferr.Value()), prefix+flagName, describeSource(sources, prefix+flagName), rule)
+		}
+		errs = append(errs, message)
 	}
-	mergedArgs = append(mergedArgs, fileArgs...)
-	// "<exe> command* argFileCommands... argFileArgs... argsAfterArgsFileTxt..."
-	mergedArgs = append(mergedArgs, args[len(parentCommands)+2:]...)
-	return mergedArgs, ctx, nil
+	return errors.New(strings.Join(errs, "\n"))
 }
 
-func (cs Commands) usage(args []string) usage {
+func (cs Commands) usage(ctx context.Context, args []string) usage {
+	return usage{Description: cs.describe(ctx, args) + "flag: help requested"}
+}
+
+// find returns the command with the name or alias 'name', or when enabled by Options.PrefixMatching, the only command starting with 'name'
+func (cs Commands) find(ctx context.Context, args []string, name string) (ICommand, error) {
+	name = strings.ToLower(name)
+	for _, c := range cs {
+		for _, n := range commandNames(c) {
+			if strings.ToLower(n) == name {
+				return c, nil
+			}
+		}
+	}
+	if !getOptions(ctx).PrefixMatching || name == "" {
+		return nil, nil
+	}
+	var matches []ICommand
+	var candidates []string
+	for _, c := range cs {
+		for _, n := range commandNames(c) {
+			if strings.HasPrefix(strings.ToLower(n), name) {
+				matches = append(matches, c)
+				candidates = append(candidates, "\""+c.Name()+"\"")
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	default:
+		message := fmt.Sprintf("ambiguous command \"%s\", could be %s", name, strings.Join(candidates, ", "))
+		return nil, usage{Description: cs.describe(ctx, args) + message}
+	}
+}
+
+// commandNames returns the name of a command followed by its aliases
+func commandNames(c ICommand) []string {
+	names := []string{c.Name()}
+	if a, ok := c.(CommandAliases); ok {
+		names = append(names, a.Aliases()...)
+	}
+	return names
+}
+
+func (cs Commands) unknownCommand(ctx context.Context, args []string, name string) usage {
+	message := fmt.Sprintf("unknown command \"%s\"", name)
+	var names []string
+	for _, c := range cs {
+		names = append(names, commandNames(c)...)
+	}
+	if suggestion := suggest(name, names); suggestion != "" {
+		message += fmt.Sprintf(", did you mean \"%s\"?", suggestion)
+	}
+	return usage{Description: cs.describe(ctx, args) + message}
+}
+
+// describeCommandName returns the name of a command and its aliases as shown in usage, eg. 'list, ls'
+func describeCommandName(c ICommand) string {
+	name := strings.Join(commandNames(c), ", ")
+	if isDefaultCommand(c) {
+		name += " (default)"
+	}
+	return name
+}
+
+// defaultCommand returns the command marked by Default, if any
+func (cs Commands) defaultCommand() ICommand {
+	for _, c := range cs {
+		if isDefaultCommand(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+func isHelpArg(arg string) bool {
+	switch arg {
+	case "help", "-h", "-help", "--help":
+		return true
+	}
+	return false
+}
+
+// describe lists the commands
+func (cs Commands) describe(ctx context.Context, args []string) string {
 	desc := "Usage of " + args[0] + " [command]:\n"
+	options := getOptions(ctx)
+	if (options.RootFlags != nil || options.ConfigFlag || options.Profiles) && len(getParentCommands(ctx)) == 0 {
+		desc = "Usage of " + args[0] + " [flags] [command]:\n"
+	}
 	nameWidth := 0
 	for _, c := range cs {
 		if c.Name() == "" {
 			panic(reflect.TypeOf(c).String() + " has no ICommand.Name()")
 		}
-		if l := len(c.Name()); l > nameWidth {
+		if l := len(describeCommandName(c)); l > nameWidth {
 			nameWidth = l
 		}
 	}
 	nameWidth = nameWidth + nameWidth%4 + 4
 	for _, c := range cs {
 		desc += "  "
+		name := describeCommandName(c)
 		if c.Usage() != "" {
-			desc += c.Name() + strings.Repeat(" ", nameWidth-len(c.Name()))
+			desc += name + strings.Repeat(" ", nameWidth-len(name))
 			desc += c.Usage()
 		} else {
-			desc += c.Name()
+			desc += name
 		}
 		desc += "\n"
 	}
-	desc += "flag: help requested"
-	return usage{Description: desc}
+	var flags bytes.Buffer
+	if (options.RootFlags != nil || options.ConfigFlag || options.Profiles) && len(getParentCommands(ctx)) == 0 {
+		fmt.Fprintln(&flags, "Flags:")
+		fs := rootUsageFlags(options)
+		fs.SetOutput(&flags)
+		fs.PrintDefaults()
+	}
+	printGlobalFlags(&flags, options)
+	if names := GetConfigFiles(ctx); len(names) > 0 {
+		fmt.Fprintln(&flags, "Config files:")
+		for _, name := range names {
+			fmt.Fprintln(&flags, "  "+name)
+		}
+	}
+	return desc + flags.String()
 }
 
 // commandArgs = args[2:]
-func parseCommandFlags(commandFlags interface{}, positionalArgs []string, commandArgs []string) (remaining []string, updatedFlags interface{}, err error) {
+func parseCommandFlags(ctx context.Context, commandFlags interface{}, positionalArgs []string, commandArgs []string) (remaining []string, updatedFlags interface{}, sources Sources, err error) {
 	if commandFlags != nil {
 		ft := reflect.TypeOf(commandFlags)
 		if ft.Kind() == reflect.Ptr {
@@ -281,21 +520,43 @@ func parseCommandFlags(commandFlags interface{}, positionalArgs []string, comman
 		}
 		v := reflect.New(ft)
 		name := os.Args[0]
-		for _, posArg := range positionalArgs {
-			name += " [" + posArg + "]"
+		for _, posArg := range parsePositionalArgs(positionalArgs) {
+			name += " " + posArg.String()
+		}
+		if len(positionalArgs) > 0 && acceptsRemainingArgs(positionalArgs) {
+			name += " " + remainingArgsSpec
 		}
-		fs := NewFlagSet(name, commandFlags)
+		fs := newFlagSet(name, commandFlags)
+		fs.options = getOptions(ctx)
+		fs.path = getParentCommands(ctx)
+		fs.argSources = tailSources(getArgSources(ctx), len(commandArgs))
+		fs.config = getConfig(ctx)
+		fs.env = getEnvLayer(ctx)
 		err = handleError(func() error {
 			switch v.Elem().Kind() {
 			case reflect.Slice:
 				updatedFlags = commandArgs
 			default:
-				remaining_, unmarshalErr := fs.UnmarshalFlags(commandArgs, v.Interface())
+				remaining_, c, unmarshalErr := fs.unmarshalFlags(commandArgs, v.Interface())
 				if unmarshalErr != nil {
 					return unmarshalErr
 				}
-				remaining_ = fillPositionalArgs(positionalArgs, v, remaining_)
+				afterFlags := len(commandArgs) - len(remaining_)
+				filled := map[string]int{}
+				remaining_, fillErr := fillPositionalArgs(positionalArgs, v, remaining_, filled)
+				if fillErr == nil {
+					fs.addPositionalSources(c, filled, afterFlags)
+					fs.resolveArgFilePaths(c)
+					fillErr = c.runHooks(filled)
+				}
+				if fillErr != nil {
+					if _, ok := fillErr.(flagConfigError); !ok {
+						printCommandUsage(ctx, commandFlags, positionalArgs)
+					}
+					return fillErr
+				}
 				updatedFlags = reflect.Indirect(v).Interface()
+				sources = fs.Sources()
 				remaining = remaining_
 			}
 			return nil
@@ -304,6 +565,12 @@ func parseCommandFlags(commandFlags interface{}, positionalArgs []string, comman
 	return
 }
 
+// printCommandUsage prints the usage of a command's flags and positional arguments
+func printCommandUsage(ctx context.Context, commandFlags interface{}, positionalArgs []string) {
+	// TODO implement flags.PrintUsage()
+	_, _, _, _ = parseCommandFlags(ctx, commandFlags, positionalArgs, []string{"--help"})
+}
+
 func handleError(f func() error) error {
 	switch err := f().(type) {
 	case nil:
@@ -317,6 +584,27 @@ func handleError(f func() error) error {
 	}
 }
 
+// getFlagPrefixForError returns the prefix of the flag names of the nested struct with the field of a validation error, eg. "nested."
+func getFlagPrefixForError(e validator.FieldError, v interface{}) string {
+	t := reflect.Indirect(reflect.ValueOf(v)).Type()
+	path := strings.Split(e.StructNamespace(), ".")[1:]
+	var prefix string
+	for _, name := range path[:len(path)-1] {
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return prefix
+		}
+		if flagName := strings.Split(field.Tag.Get("flag"), ",")[0]; flagName != "" && flagName != "-" {
+			prefix += flagName + "."
+		}
+		t = field.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	return prefix
+}
+
 func getStructFieldForError(e validator.FieldError, v interface{}) (reflect.StructField, bool) {
 	cursor := reflect.ValueOf(v)
 	path := strings.Split(e.StructNamespace(), ".")[1:]
@@ -356,7 +644,24 @@ type FlagSet interface {
 	UnmarshalFlags(argsAndFlags []string, a interface{}) (args []string, err error)
 }
 
+// FlagSetSources is optionally implemented by a FlagSet, it is implemented by the FlagSets of NewFlagSet and NewFlagSetWithOptions
+type FlagSetSources interface {
+	// Sources returns the source of the value of each flag after UnmarshalFlags, see Sources
+	Sources() Sources
+}
+
 func NewFlagSet(name string, defaults interface{}) FlagSet {
+	return newFlagSet(name, defaults)
+}
+
+// NewFlagSetWithOptions creates a FlagSet that applies the environment variable options, eg. Options.EnvPrefix
+func NewFlagSetWithOptions(name string, defaults interface{}, options Options) FlagSet {
+	fs := newFlagSet(name, defaults)
+	fs.options = options
+	return fs
+}
+
+func newFlagSet(name string, defaults interface{}) flagSet {
 	v := reflect.Indirect(reflect.ValueOf(defaults))
 	if v.Kind() != reflect.Struct && v.Kind() != reflect.Slice {
 		panic("expected struct or slice type, got: " + v.Type().String())
@@ -364,26 +669,55 @@ func NewFlagSet(name string, defaults interface{}) FlagSet {
 	return flagSet{
 		name:     name,
 		defaults: v.Interface(),
+		sources:  Sources{},
 	}
 }
 
 type flagSet struct {
 	name     string
 	defaults interface{}
+	// options and the command path set by Commands.Run
+	options Options
+	path    []string
+	// argSources are the sources of the arguments, set by Commands.Run for arguments from an argfile
+	argSources []Source
+	// sources are filled by UnmarshalFlags
+	sources Sources
+	// config are the config files read by Commands.Run, otherwise UnmarshalFlags reads Options.ConfigFiles
+	config []configFile
+	// env are the environment variables of the argfiles, set by Commands.Run
+	env envLayer
 }
 
 type flagInfo struct {
-	name     string
-	usage    string
-	env      string
-	validate string
-	set      func()
+	name       string
+	squash     bool
+	positional string
+	usage      string
+	defaultTag string
+	env        string
+	validate   string
+	envFile    bool
+	envErr     error
+	configErr  error
+	// path is set for a field with a path, see resolveArgFilePaths
+	path bool
+	// source is the default, or environment variable, of the value
+	source Source
+	set    func()
+	// field is the field of the flags struct
+	field reflect.Value
 }
 
 func (fi flagInfo) fullUsage() string {
 	usage := fi.usage
-	if fi.env != "" {
-		usage += " (env \"" + fi.env + "\")"
+	if names := fi.envNames(); len(names) > 0 {
+		if fi.envFile {
+			for _, name := range fi.envNames() {
+				names = append(names, name+envFileSuffix)
+			}
+		}
+		usage += " (env \"" + strings.Join(names, "\", \"") + "\")"
 	}
 	if fi.validate != "" {
 		usage += " (" + fi.validate + ")"
@@ -391,54 +725,50 @@ func (fi flagInfo) fullUsage() string {
 	return usage
 }
 
-func (fi flagInfo) readEnv(valuePtr interface{}) bool {
-	if fi.env == "" {
-		return false
-	}
-	envValue, ok := os.LookupEnv(fi.env)
-	if !ok {
-		return false
-	}
-	value := reflect.ValueOf(valuePtr).Elem()
-	switch value.Kind() {
-	case reflect.String:
-		value.SetString(envValue)
-		return true
-	case reflect.Bool:
-		truthy, err := strconv.ParseBool(envValue)
-		if err != nil {
-			return false
-		}
-		value.SetBool(truthy)
-		return true
-	case reflect.Int:
-		integer, err := strconv.ParseInt(envValue, 10, 64)
-		if err != nil {
-			return false
-		}
-		value.SetInt(integer)
-		return true
-	}
-	return false
+func readFlagInfo(t reflect.Type, prefix string, i int) (*flagInfo, bool) {
+	return readFieldFlagInfo(t.Field(i), prefix)
 }
 
-func readFlagInfo(t reflect.Type, prefix string, i int) (*flagInfo, bool) {
-	f := t.Field(i)
+func readFieldFlagInfo(f reflect.StructField, prefix string) (*flagInfo, bool) {
 	tag := f.Tag
 	flagTag := strings.Split(tag.Get("flag"), ",")
 	if flagTag[0] == "" {
-		return nil, false
+		// embedded structs are squashed
+		if !f.Anonymous || f.Type.Kind() != reflect.Struct {
+			return nil, false
+		}
+		flagTag[0] = "-"
 	}
 	info := flagInfo{
-		name:     prefix + flagTag[0],
-		usage:    tag.Get("usage"),
-		env:      tag.Get("env"),
-		validate: tag.Get("validate"),
+		name:       prefix + flagTag[0],
+		squash:     flagTag[0] == "-",
+		envFile:    hasFlagOption(flagTag[1:], envFileOption),
+		positional: readPositionalArg(flagTag[0]),
+		usage:      tag.Get("usage"),
+		defaultTag: tag.Get("default"),
+		env:        tag.Get("env"),
+		validate:   tag.Get("validate"),
 	}
+	info.path = hasFlagOption(flagTag[1:], pathOption) || isPathValidation(info.validate)
 	return &info, true
 }
 
+// UnmarshalFlags parses the flags into 'a', then calls SetDefaults and Normalize, see FlagDefaulter and FlagNormalizer
 func (s flagSet) UnmarshalFlags(args []string, a interface{}) ([]string, error) {
+	remaining, c, err := s.unmarshalFlags(args, a)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.runHooks(nil); err != nil {
+		fmt.Fprintln(c.fs.Output(), err.Error())
+		c.fs.Usage()
+		return nil, err
+	}
+	return remaining, nil
+}
+
+// unmarshalFlags parses the flags into 'a', the returned collector runs the hooks once the positional arguments are filled
+func (s flagSet) unmarshalFlags(args []string, a interface{}) ([]string, *flagCollector, error) {
 	name := os.Args[0]
 	if s.name != "" {
 		name = s.name
@@ -446,179 +776,163 @@ func (s flagSet) UnmarshalFlags(args []string, a interface{}) ([]string, error)
 	fs := flag.NewFlagSet(name, flag.ContinueOnError)
 	defaults := reflect.ValueOf(s.defaults)
 	focus := reflect.ValueOf(a)
-	var flags []flagInfo
-	seen := map[reflect.Type]*struct{}{}
-	flags = collectStructFlags(fs, flags, "", defaults, focus, seen)
-	if err := fs.Parse(args); err != nil {
-		return nil, err
-	}
-	// build leaves first
-	for i := len(flags) - 1; i >= 0; i-- {
-		f := flags[i]
-		f.set()
+	c := flagCollector{fs: fs, seen: map[reflect.Type]*struct{}{}, autoEnv: s.options.AutoEnv, envPrefix: s.envPrefix(), envFiles: s.options.EnvFiles, env: s.env}
+	config := s.config
+	if config == nil && len(s.options.ConfigFiles) > 0 {
+		files, err := loadConfigFiles(s.options.ConfigFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		config = files
 	}
-	return fs.Args(), nil
-}
-
-func fillPositionalArgs(positionalArgs []string, value reflect.Value, argsAfterFlags []string) []string {
-	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
-		panic("expected *struct{}, got: " + value.String())
+	c.config = configLayers(config, s.path)
+	c.collect("", defaults, focus)
+	c.checkConstraintFlags()
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", name)
+		fs.PrintDefaults()
+		printConstraints(fs.Output(), c.constraints)
+		printGlobalFlags(fs.Output(), s.options)
 	}
-	value = value.Elem()
-	pos := 0
-	done := func() bool {
-		if pos > len(positionalArgs)-1 || pos > len(argsAfterFlags)-1 {
-			return true
+	// errors and usage are printed here, to suggest flags for typos
+	out := fs.Output()
+	fs.SetOutput(ioutil.Discard)
+	err := fs.Parse(args)
+	fs.SetOutput(out)
+	if err != nil {
+		if err != flag.ErrHelp {
+			err = suggestFlag(fs, err)
+			fmt.Fprintln(fs.Output(), err.Error())
 		}
-		return false
+		fs.Usage()
+		return nil, nil, err
 	}
-Args:
-	for _, argName := range positionalArgs {
-		if done() {
-			break
-		}
-		for i := 0; i < value.NumField(); i++ {
-			info, ok := readFlagInfo(value.Type(), "", i)
-			if !ok || readPositionalArg(info.name) != argName {
-				continue
-			}
-			fieldValue := value.Field(i)
-			switch fieldValue.Kind() {
-			case reflect.String:
-				s := argsAfterFlags[pos]
-				fieldValue.SetString(s)
-				info.set = func() {
-					fieldValue.SetString(s)
-				}
-				pos++
-				continue Args
-			case reflect.Slice:
-				arr := append([]string{}, argsAfterFlags[pos:]...)
-				fieldValue.Set(reflect.ValueOf(arr))
-				return []string{}
+	if s.config == nil {
+		// the keys were not checked by Commands.Run
+		for _, f := range config {
+			if err := checkConfigKeys(f.name, "", f.values, []*flag.FlagSet{fs}, nil, s.options); err != nil {
+				return nil, nil, err
 			}
 		}
-		break
 	}
-	return argsAfterFlags[pos:]
+	if err := c.checkConfig(); err != nil {
+		fmt.Fprintln(fs.Output(), err.Error())
+		fs.Usage()
+		return nil, nil, err
+	}
+	if err := c.checkEnv(s.options.LenientEnv); err != nil {
+		fmt.Fprintln(fs.Output(), err.Error())
+		fs.Usage()
+		return nil, nil, err
+	}
+	if err := c.checkConstraints(); err != nil {
+		fmt.Fprintln(fs.Output(), err.Error())
+		fs.Usage()
+		return nil, nil, err
+	}
+	// build leaves first
+	for i := len(c.flags) - 1; i >= 0; i-- {
+		f := c.flags[i]
+		f.set()
+	}
+	s.setSources(&c, args)
+	return fs.Args(), &c, nil
+}
+
+// flagCollector registers the fields of a flags struct, and its nested structs, with a flag.FlagSet
+type flagCollector struct {
+	fs          *flag.FlagSet
+	flags       []flagInfo
+	constraints []FlagConstraint
+	hooks       []flagHook
+	seen        map[reflect.Type]*struct{}
+	// autoEnv and envPrefix derive environment variable names, see Options.AutoEnv
+	autoEnv   bool
+	envPrefix string
+	// envFiles reads every environment variable from <NAME>_FILE too, see Options.EnvFiles
+	envFiles bool
+	// env are the environment variables of the argfiles
+	env envLayer
+	// config are the sections of the config files for the flag set, see Options.ConfigFiles
+	config []configLayer
 }
 
-func collectStructFlags(fs *flag.FlagSet, collected []flagInfo, prefix string, defaults, focus reflect.Value, seen map[reflect.Type]*struct{}) []flagInfo {
+func (c *flagCollector) collect(prefix string, defaults, focus reflect.Value) {
+	fs := c.fs
 	if focus.Kind() != reflect.Ptr || focus.Elem().Type() != defaults.Type() {
 		panic("expected *" + defaults.String() + ", got: " + focus.String())
 	}
-	if _, ok := seen[focus.Type()]; ok {
+	if _, ok := c.seen[focus.Type()]; ok {
 		panic("cycle in flag types found for type: " + focus.String())
 	}
-	seen[focus.Type()] = nil
+	c.seen[focus.Type()] = nil
+	if fc, ok := focus.Interface().(FlagConstraints); ok {
+		for _, constraint := range fc.FlagConstraints() {
+			c.constraints = append(c.constraints, constraint.withPrefix(prefix))
+		}
+	}
 	for i := 0; i < defaults.NumField(); i++ {
 		info, ok := readFlagInfo(defaults.Type(), prefix, i)
-		if !ok && readPositionalArg(info.name) == "" {
+		if !ok {
 			continue
 		}
+		info.env = c.resolveEnv(info)
+		info.envFile = info.envFile || c.envFiles
 		fieldValue := focus.Elem().Field(i)
-		switch fieldValue.Kind() {
-		case reflect.String:
-			df := defaults.Field(i).String()
-			info.readEnv(&df)
-			s := fs.String(info.name, df, info.fullUsage())
-			info.set = func() {
-				fieldValue.SetString(*s)
+		info.field = fieldValue
+		if info.positional != "" {
+			// filled after parsing by fillPositionalArgs, the name is used by SetFlags
+			info.name = prefix + info.positional
+			df := reflect.New(fieldValue.Type()).Elem()
+			df.Set(defaults.Field(i))
+			if info.applyDefaultTag(df, c.env, func(s string) error {
+				return setScalar(df, s)
+			}) {
+				info.source.Kind = FromDefaultTag
 			}
-		case reflect.Bool:
-			df := defaults.Field(i).Bool()
-			info.readEnv(&df)
-			b := fs.Bool(info.name, df, info.fullUsage())
 			info.set = func() {
-				fieldValue.SetBool(*b)
+				fieldValue.Set(df)
 			}
-		case reflect.Int:
-			df := defaults.Field(i).Int()
-			info.readEnv(&df)
-			i := fs.Int(info.name, int(df), info.fullUsage())
-			info.set = func() {
-				fieldValue.SetInt(int64(*i))
-			}
-		case reflect.Map:
-			if fieldValue.Type().Key().Kind() != reflect.String {
-				continue
-			}
-			sm := stringMap{}
-			fs.Var(&sm, info.name, info.fullUsage())
-			info.set = func() {
-				m := map[string]string{}
-				for _, e := range sm {
-					m[e.key] = e.value
-				}
-				fieldValue.Set(reflect.ValueOf(m))
-			}
-		case reflect.Slice:
-			arr := stringArray{}
-			fs.Var(&arr, info.name, info.fullUsage())
-			info.set = func() {
-				fieldValue.Set(reflect.ValueOf(arr))
-			}
-		case reflect.Struct, reflect.Interface:
-			prefix := ""
-			if info.name != "-" {
+			c.flags = append(c.flags, *info)
+			continue
+		}
+		if k := fieldValue.Kind(); (k == reflect.Struct || k == reflect.Interface) && !isScalar(fieldValue.Type()) {
+			prefix := prefix
+			if !info.squash {
 				prefix = info.name + "."
 			}
-			collected = collectStructFlags(fs, collected, prefix, defaults.Field(i), fieldValue.Addr(), seen)
+			c.collect(prefix, defaults.Field(i), fieldValue.Addr())
 			continue
-		default:
+		}
+		value := reflect.New(fieldValue.Type()).Elem()
+		value.Set(defaults.Field(i))
+		if !registerFlag(fs, info.name, info.fullUsage(), value) {
 			continue
 		}
-		collected = append(collected, *info)
-	}
-	delete(seen, focus.Type())
-	return collected
-}
-
-type stringArray []string
-
-func (sa stringArray) String() string {
-	return strings.Join(sa, ",")
-}
-
-func (sa *stringArray) Set(v string) error {
-	*sa = append(*sa, strings.Split(v, ",")...)
-	return nil
-}
-
-func (sa stringArray) Get() interface{} {
-	return sa
-}
-
-type stringMapEntry struct {
-	key   string
-	value string
-}
-
-type stringMap []stringMapEntry
-
-func (sm stringMap) String() string {
-	var entries []string
-	for _, e := range sm {
-		entries = append(entries, e.key+"="+e.value)
-	}
-	return strings.Join(entries, ",")
-}
-
-func (sm *stringMap) Set(v string) error {
-	entries := strings.Split(v, ",")
-	for _, e := range entries {
-		kv := strings.SplitN(e, "=", 2)
-		if len(kv) == 1 {
-			*sm = append(*sm, stringMapEntry{key: kv[0]})
-		} else {
-			*sm = append(*sm, stringMapEntry{key: kv[0], value: kv[1]})
+		if f := fs.Lookup(info.name); info.applyDefaultTag(value, c.env, f.Value.Set) {
+			f.DefValue = f.Value.String()
+			if r, ok := f.Value.(resettable); ok {
+				r.reset()
+			}
+			info.source.Kind = FromDefaultTag
 		}
+		info.configErr = c.readConfig(info, fs.Lookup(info.name), value)
+		envName, err := info.readEnv(fs.Lookup(info.name), value, c.env)
+		if envName != "" {
+			info.source = Source{Kind: FromEnv, Name: envName}
+		}
+		info.envErr = err
+		info.set = func() {
+			fieldValue.Set(value)
+		}
+		c.flags = append(c.flags, *info)
 	}
-	return nil
-}
-
-func (sm stringMap) Get() interface{} {
-	return sm
+	// hooks of nested structs are added first
+	switch focus.Interface().(type) {
+	case FlagDefaulter, FlagNormalizer:
+		c.hooks = append(c.hooks, flagHook{prefix: prefix, focus: focus})
+	}
+	delete(c.seen, focus.Type())
 }
 
 var errorType = reflect.TypeOf((*error)(nil)).Elem()
@@ -633,21 +947,27 @@ type command struct {
 }
 
 func (c command) Name() string {
+	return splitAliases(c.names())[0]
+}
+
+func (c command) Aliases() []string {
+	return splitAliases(c.names())[1:]
+}
+
+func (c command) names() string {
 	parts := strings.SplitN(strings.Replace(c.name, "  ", " ", -1), " ", 2)
 	return parts[0]
 }
 
-func readPositionalArg(arg string) string {
-	if len(arg) > 2 && arg[0] == '[' && arg[len(arg)-1] == ']' {
-		return arg[1 : len(arg)-1]
-	}
-	return ""
+// splitAliases splits a name such as "list|ls", into its name and aliases
+func splitAliases(names string) []string {
+	return strings.Split(names, "|")
 }
 
 func (c command) PositionalArgs() (args []string) {
 	parts := strings.Split(strings.Replace(c.name, "  ", " ", -1), " ")
-	for _, arg := range parts[1:] {
-		if arg := readPositionalArg(arg); arg != "" {
+	for i, arg := range parts[1:] {
+		if _, ok := parsePositionalArg(arg); ok || (arg == remainingArgsSpec && i == len(parts)-2) {
 			args = append(args, arg)
 		} else {
 			panic("invalid positional args: " + c.name)
@@ -669,13 +989,18 @@ func (c command) Execute(ctx context.Context, arg interface{}) error {
 }
 
 type commandGroup struct {
-	name     string
-	usage    string
-	commands Commands
+	name         string
+	usage        string
+	defaultFlags interface{}
+	commands     Commands
 }
 
 func (c commandGroup) Name() string {
-	return c.name
+	return splitAliases(c.name)[0]
+}
+
+func (c commandGroup) Aliases() []string {
+	return splitAliases(c.name)[1:]
 }
 
 func (c commandGroup) Usage() string {
@@ -685,3 +1010,40 @@ func (c commandGroup) Usage() string {
 func (c commandGroup) Commands() Commands {
 	return c.commands
 }
+
+func (c commandGroup) DefaultFlags() interface{} {
+	return c.defaultFlags
+}
+
+type defaultCommand struct {
+	Command
+}
+
+func (c defaultCommand) Aliases() []string {
+	return commandNames(c.Command)[1:]
+}
+
+type defaultCommandGroup struct {
+	CommandGroup
+}
+
+func (c defaultCommandGroup) Aliases() []string {
+	return commandNames(c.CommandGroup)[1:]
+}
+
+// defaultCommandGroupWithFlags keeps the CommandGroupFlags of a group marked by Default
+type defaultCommandGroupWithFlags struct {
+	defaultCommandGroup
+}
+
+func (c defaultCommandGroupWithFlags) DefaultFlags() interface{} {
+	return c.CommandGroup.(CommandGroupFlags).DefaultFlags()
+}
+
+func isDefaultCommand(c ICommand) bool {
+	switch c.(type) {
+	case defaultCommand, defaultCommandGroup, defaultCommandGroupWithFlags:
+		return true
+	}
+	return false
+}
@@ -201,3 +201,169 @@ func TestArgFile(t *testing.T) {
 	require.Equal(t, "a1", collectedFlags.StringFromEnv)
 	require.Equal(t, "1", collectedFlags.IntFromEnvValue)
 }
+
+func TestCommandAliases(t *testing.T) {
+
+	type cmd struct{}
+
+	value := ""
+
+	newCommand := func(name string) Command {
+		return NewCommand(name, cmd{}, "", func(_ context.Context, _ cmd) error {
+			value = name
+			return nil
+		})
+	}
+
+	commands := Commands{
+		newCommand("list|ls"),
+		newCommand("login"),
+		NewCommandGroup("remote|r", "", newCommand("show")),
+	}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "ls"}))
+	require.Equal(t, "list|ls", value)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "r", "show"}))
+	require.Equal(t, "show", value)
+
+	err := commands.Run(context.TODO(), []string{"<exe>", "lo"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "  list, ls\n")
+	assert.Contains(t, err.Error(), "unknown command \"lo\"")
+
+	ctx := WithOptions(context.TODO(), Options{PrefixMatching: true})
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "log"}))
+	require.Equal(t, "login", value)
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "rem", "sh"}))
+	require.Equal(t, "show", value)
+
+	err = commands.Run(ctx, []string{"<exe>", "l"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous command \"l\", could be \"list\", \"login\"")
+}
+
+func TestDefaultCommand(t *testing.T) {
+
+	type cmd struct {
+		String string `flag:"string"`
+	}
+
+	value := ""
+
+	newCommand := func(name string) Command {
+		return NewCommand(name, cmd{String: "default"}, "", func(_ context.Context, flags cmd) error {
+			value = name + " " + flags.String
+			return nil
+		})
+	}
+
+	commands := Commands{
+		Default(newCommand("status")),
+		NewCommandGroup("more", "", newCommand("list"), Default(newCommand("show|s"))),
+		NewCommandGroup("none", "", newCommand("other")),
+	}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>"}))
+	require.Equal(t, "status default", value)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "more"}))
+	require.Equal(t, "show|s default", value)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "more", "s", "--string=1"}))
+	require.Equal(t, "show|s 1", value)
+
+	err := commands.Run(context.TODO(), []string{"<exe>", "none"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "flag: help requested")
+
+	err = commands.Run(context.TODO(), []string{"<exe>", "more", "help"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "  show, s (default)\n")
+}
+
+func TestCommandGroupFlags(t *testing.T) {
+
+	type clusterFlags struct {
+		Context string `flag:"context" validate:"required"`
+	}
+
+	type listFlags struct {
+		All bool `flag:"all"`
+	}
+
+	var cluster clusterFlags
+	var list listFlags
+
+	command := NewCommand("list", listFlags{}, "", func(ctx context.Context, flags listFlags) error {
+		list = flags
+		require.True(t, GetGroupFlags(ctx, &cluster))
+		return nil
+	})
+
+	commands := Commands{
+		NewCommandGroupWithFlags("cluster", "", clusterFlags{Context: "dev"}, NewCommandGroup("nodes", "", command)),
+	}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "--context=prod", "nodes", "list", "--all"}))
+	require.Equal(t, clusterFlags{Context: "prod"}, cluster)
+	require.Equal(t, listFlags{All: true}, list)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "nodes", "list"}))
+	require.Equal(t, clusterFlags{Context: "dev"}, cluster)
+
+	require.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "--context=", "nodes", "list"}), "invalid value \"\" for flag -context: validation failed for rule 'required'")
+
+	require.False(t, GetGroupFlags(context.TODO(), &cluster))
+
+	// a default group keeps its flags
+	commands = Commands{
+		Default(NewCommandGroupWithFlags("cluster", "", clusterFlags{Context: "dev"}, Default(command))),
+	}
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cluster", "--context=prod", "list"}))
+	require.Equal(t, clusterFlags{Context: "prod"}, cluster)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>"}))
+	require.Equal(t, clusterFlags{Context: "dev"}, cluster)
+}
+
+func TestRootFlags(t *testing.T) {
+
+	type rootFlags struct {
+		Chdir   string `flag:"chdir"`
+		Version bool   `flag:"version"`
+	}
+
+	type cmd struct {
+		String string `flag:"string"`
+	}
+
+	var root rootFlags
+	var flags cmd
+
+	command := NewCommand("cmd", cmd{}, "", func(ctx context.Context, f cmd) error {
+		require.True(t, GetRootFlags(ctx, &root))
+		flags = f
+		return nil
+	})
+
+	commands := Commands{Default(command)}
+	ctx := WithOptions(context.TODO(), Options{RootFlags: rootFlags{Chdir: "."}})
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--chdir=/tmp", "cmd", "--string=a"}))
+	assert.Equal(t, rootFlags{Chdir: "/tmp"}, root)
+	assert.Equal(t, cmd{String: "a"}, flags)
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--version"}))
+	assert.Equal(t, rootFlags{Chdir: ".", Version: true}, root)
+	assert.Equal(t, cmd{}, flags)
+
+	err := commands.Run(ctx, []string{"<exe>", "--help"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Usage of <exe> [flags] [command]:\n")
+	assert.Contains(t, err.Error(), "Flags:\n  -chdir string\n")
+
+	require.EqualError(t, commands.Run(ctx, []string{"<exe>", "--chdr=/tmp", "cmd"}), "flag provided but not defined: -chdr, did you mean -chdir?")
+}
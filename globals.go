@@ -0,0 +1,213 @@
+package struct_flags
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gopkg.in/go-playground/validator.v9"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+var globalFlagsKey = contextKey{value: 6}
+
+type parsedGlobalFlags struct {
+	// args are the global flags taken from the arguments so far
+	args []string
+	// sources are the sources of args
+	sources []Source
+	flags   interface{}
+}
+
+// GetGlobalFlags sets 'flags', a pointer to the type of Options.GlobalFlags, to the parsed global flags
+func GetGlobalFlags(ctx context.Context, flags interface{}) bool {
+	parsed, ok := ctx.Value(globalFlagsKey).(parsedGlobalFlags)
+	if !ok {
+		return false
+	}
+	return assignFlags(flags, parsed.flags)
+}
+
+// parseGlobalFlags takes the global flags out of the arguments and parses them. Global flags found later,
+// eg. in an argfile, are parsed together with the ones found before.
+func (cs Commands) parseGlobalFlags(ctx context.Context, args []string) (context.Context, []string, error) {
+	defaults := getOptions(ctx).GlobalFlags
+	if defaults == nil || len(args) == 0 {
+		return ctx, args, nil
+	}
+	options := getOptions(ctx)
+	globals := lookupFlags(defaults, options)
+	extracted, remaining, matched := extractFlags(globals, cs.commandFlags(ctx, globals, args), args[1:])
+	previous, parsed := ctx.Value(globalFlagsKey).(parsedGlobalFlags)
+	if parsed && len(extracted) == 0 {
+		return ctx, args, nil
+	}
+	globalArgs := append(append([]string{}, previous.args...), extracted...)
+	// the sources of the global flags, eg. an argfile, are kept with them
+	globalSources := append([]Source{}, previous.sources...)
+	var remainingSources []Source
+	for i, source := range tailSources(getArgSources(ctx), len(args)-1) {
+		if matched[i] {
+			globalSources = append(globalSources, source)
+		} else {
+			remainingSources = append(remainingSources, source)
+		}
+	}
+	// the global flags are not listed twice in their own usage
+	options.GlobalFlags = nil
+	globalCtx := context.WithValue(withArgSources(WithOptions(context.Background(), options), globalSources), configKey, getConfig(ctx))
+	_, flags, sources, err := parseCommandFlags(withEnvLayer(globalCtx, getEnvLayer(ctx)), defaults, nil, globalArgs)
+	if err != nil {
+		return ctx, args, err
+	}
+	if ValidateStructFields != nil {
+		if err := ValidateStructFields(flags); err != nil {
+			if verr, ok := err.(validator.ValidationErrors); ok {
+				return ctx, args, describeValidationErrors(ctx, verr, flags, nil, sources)
+			}
+			return ctx, args, err
+		}
+	}
+	ctx = context.WithValue(ctx, globalFlagsKey, parsedGlobalFlags{args: globalArgs, sources: globalSources, flags: flags})
+	if getArgSources(ctx) != nil {
+		ctx = withArgSources(ctx, remainingSources)
+	}
+	return ctx, append([]string{args[0]}, remaining...), nil
+}
+
+// lookupFlags registers the flags of a flags struct, to look them up by name
+func lookupFlags(defaults interface{}, options Options) *flag.FlagSet {
+	v := reflect.Indirect(reflect.ValueOf(defaults))
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	c := flagCollector{fs: fs, seen: map[reflect.Type]*struct{}{}, autoEnv: options.AutoEnv, envPrefix: envName(options.EnvPrefix), envFiles: options.EnvFiles}
+	c.collect("", v, reflect.New(v.Type()))
+	return fs
+}
+
+// commandFlags looks up the flags of the root, the groups and the command named in the arguments, the values of their flags
+// are not taken for global flags, eg. '-v' in 'cmd --name -v'
+func (cs Commands) commandFlags(ctx context.Context, globals *flag.FlagSet, args []string) *flag.FlagSet {
+	options := getOptions(ctx)
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	add := func(defaults interface{}) {
+		if defaults == nil || reflect.Indirect(reflect.ValueOf(defaults)).Kind() != reflect.Struct {
+			return
+		}
+		lookupFlags(defaults, options).VisitAll(func(f *flag.Flag) {
+			if fs.Lookup(f.Name) == nil {
+				fs.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+	}
+	parents := len(getParentCommands(ctx))
+	if parents == 0 {
+		add(options.RootFlags)
+	}
+	commands := cs
+	for i := parents + 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if len(arg) > 1 && arg[0] == '-' {
+			f, hasValue := lookupArg(globals, arg)
+			if f == nil {
+				f, hasValue = lookupArg(fs, arg)
+			}
+			if f != nil && !hasValue && !isBoolFlag(f) {
+				i++
+			}
+			continue
+		}
+		found, _ := commands.find(ctx, args, arg)
+		switch t := found.(type) {
+		case Command:
+			add(t.DefaultFlags())
+			return fs
+		case CommandGroup:
+			if g, ok := t.(CommandGroupFlags); ok {
+				add(g.DefaultFlags())
+			}
+			commands = t.Commands()
+		default:
+			return fs
+		}
+	}
+	return fs
+}
+
+// extractFlags separates the flags defined in 'fs', and their values, from the other arguments. Arguments after '--' are not extracted.
+// The values of the flags defined in 'other' are skipped. 'matched' is true for the extracted arguments.
+func extractFlags(fs, other *flag.FlagSet, args []string) (extracted, remaining []string, matched []bool) {
+	matched = make([]bool, len(args))
+	scanFlags(fs, other, args, func(_ *flag.Flag, i, n int) {
+		for j := i; j < i+n; j++ {
+			matched[j] = true
+		}
+	})
+	for i, arg := range args {
+		if matched[i] {
+			extracted = append(extracted, arg)
+		} else {
+			remaining = append(remaining, arg)
+		}
+	}
+	return
+}
+
+// scanFlags calls 'found' for each flag defined in 'fs', with the index of its argument and the number of arguments it takes.
+// The values of the flags defined in 'other', which may be nil, are skipped. Arguments after '--' are not scanned.
+func scanFlags(fs, other *flag.FlagSet, args []string, found func(f *flag.Flag, i, n int)) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		f, hasValue := lookupArg(fs, arg)
+		if f == nil {
+			if other != nil {
+				if f, hasValue := lookupArg(other, arg); f != nil && !hasValue && !isBoolFlag(f) {
+					i++
+				}
+			}
+			continue
+		}
+		if !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			found(f, i, 2)
+			i++
+			continue
+		}
+		found(f, i, 1)
+	}
+}
+
+// lookupArg returns the flag of 'fs' named by an argument such as '-name' or '--name=value', and whether it has a value
+func lookupArg(fs *flag.FlagSet, arg string) (*flag.Flag, bool) {
+	name := strings.TrimPrefix(arg[1:], "-")
+	hasValue := false
+	if j := strings.Index(name, "="); j >= 0 {
+		name, hasValue = name[:j], true
+	}
+	return fs.Lookup(name), hasValue
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func printGlobalFlags(w io.Writer, options Options) {
+	if options.GlobalFlags == nil {
+		return
+	}
+	fs := lookupFlags(options.GlobalFlags, options)
+	fmt.Fprintln(w, "Global flags:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
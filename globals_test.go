@@ -0,0 +1,128 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGlobalFlags(t *testing.T) {
+
+	type globals struct {
+		Verbose bool   `flag:"verbose"`
+		Context string `flag:"context" validate:"required"`
+	}
+
+	type cmd struct {
+		String string `flag:"string"`
+	}
+
+	var g globals
+	var flags cmd
+	var remaining []string
+
+	command := NewCommand("cmd", cmd{}, "", func(ctx context.Context, f cmd) error {
+		require.True(t, GetGlobalFlags(ctx, &g))
+		flags = f
+		remaining = GetRemainingArgs(ctx)
+		return nil
+	})
+
+	commands := Commands{NewCommandGroup("group", "", command)}
+	ctx := WithOptions(context.TODO(), Options{GlobalFlags: globals{Context: "dev"}})
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--verbose", "group", "--context", "prod", "cmd", "--string=a", "b"}))
+	assert.Equal(t, globals{Verbose: true, Context: "prod"}, g)
+	assert.Equal(t, cmd{String: "a"}, flags)
+	assert.Equal(t, []string{"b"}, remaining)
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "group", "cmd", "--context=test", "--", "--verbose"}))
+	assert.Equal(t, globals{Context: "test"}, g)
+	assert.Equal(t, []string{"--verbose"}, remaining)
+
+	require.EqualError(t, commands.Run(ctx, []string{"<exe>", "group", "cmd", "--context="}), "invalid value \"\" for flag -context: validation failed for rule 'required'")
+
+	err := commands.Run(ctx, []string{"<exe>", "help"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Global flags:\n  -context string\n")
+}
+
+func TestGlobalFlags_CommandFlagValues(t *testing.T) {
+
+	type globals struct {
+		Verbose bool `flag:"v"`
+	}
+
+	type cluster struct {
+		Context string `flag:"context"`
+	}
+
+	type cmd struct {
+		Name string `flag:"name"`
+	}
+
+	var g globals
+	var c cluster
+	var flags cmd
+	command := NewCommand("cmd", cmd{}, "", func(ctx context.Context, f cmd) error {
+		require.True(t, GetGlobalFlags(ctx, &g))
+		GetGroupFlags(ctx, &c)
+		flags = f
+		return nil
+	})
+	ctx := WithOptions(context.TODO(), Options{GlobalFlags: globals{}})
+
+	// the value of a flag of the command is not taken for a global flag
+	require.NoError(t, Commands{command}.Run(ctx, []string{"<exe>", "cmd", "--name", "-v"}))
+	assert.Equal(t, cmd{Name: "-v"}, flags)
+	assert.Equal(t, globals{}, g)
+
+	require.NoError(t, Commands{command}.Run(ctx, []string{"<exe>", "-v", "cmd", "--name", "a"}))
+	assert.Equal(t, cmd{Name: "a"}, flags)
+	assert.Equal(t, globals{Verbose: true}, g)
+
+	// or of a group
+	commands := Commands{NewCommandGroupWithFlags("cluster", "", cluster{}, command)}
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "cluster", "--context", "-v", "cmd", "--name", "-v", "-v"}))
+	assert.Equal(t, cluster{Context: "-v"}, c)
+	assert.Equal(t, cmd{Name: "-v"}, flags)
+	assert.Equal(t, globals{Verbose: true}, g)
+}
+
+func TestExtractFlags(t *testing.T) {
+
+	type globals struct {
+		Verbose bool   `flag:"verbose"`
+		Context string `flag:"context"`
+	}
+
+	extracted, remaining, matched := extractFlags(lookupFlags(globals{}, Options{}), nil, []string{"a", "-verbose", "--context", "x", "-b", "--context=y", "--", "--verbose"})
+	assert.Equal(t, []string{"-verbose", "--context", "x", "--context=y"}, extracted)
+	assert.Equal(t, []string{"a", "-b", "--", "--verbose"}, remaining)
+	assert.Equal(t, []bool{false, true, true, true, false, true, false, false}, matched)
+}
+
+func TestGlobalFlags_ArgFileEnv(t *testing.T) {
+
+	type globals struct {
+		Token string `flag:"token" env:"TEST_GLOBAL_TOKEN"`
+	}
+
+	var g globals
+	commands := Commands{NewCommand("cmd", struct{}{}, "", func(ctx context.Context, _ struct{}) error {
+		require.True(t, GetGlobalFlags(ctx, &g))
+		return nil
+	})}
+	ctx := WithOptions(context.TODO(), Options{GlobalFlags: globals{}})
+
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	argFile := writeConfigFile(t, dir, "args.json", `{"command": ["cmd"], "env": ["TEST_GLOBAL_TOKEN=abc"]}`)
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "@" + argFile}))
+	assert.Equal(t, globals{Token: "abc"}, g)
+}
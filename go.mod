@@ -1,12 +1,14 @@
 module github.com/wav/struct_flags
 
-go 1.12
+go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/go-playground/locales v0.12.1 // indirect
 	github.com/go-playground/universal-translator v0.16.0 // indirect
 	github.com/leodido/go-urn v1.1.0 // indirect
 	github.com/stretchr/testify v1.3.0
 	golang.org/x/net v0.0.0-20190328230028-74de082e2cca
 	gopkg.in/go-playground/validator.v9 v9.27.0
+	gopkg.in/yaml.v2 v2.4.0
 )
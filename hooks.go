@@ -0,0 +1,83 @@
+package struct_flags
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+)
+
+// SetFlags holds the names of the flags, and positional arguments, that were set on the command line, by the environment or in a config file.
+// Names are relative to the struct receiving them, eg. "string1" for -nested.string1 in the nested struct.
+type SetFlags map[string]bool
+
+// IsSet reports whether the flag, or positional argument, was set explicitly
+func (s SetFlags) IsSet(name string) bool {
+	return s[name]
+}
+
+func (s SetFlags) scope(prefix string) SetFlags {
+	scoped := SetFlags{}
+	for name := range s {
+		if strings.HasPrefix(name, prefix) {
+			scoped[strings.TrimPrefix(name, prefix)] = true
+		}
+	}
+	return scoped
+}
+
+// FlagDefaulter is implemented by a flags struct, or a nested flags struct, to set defaults that depend on other flags,
+// eg. '--workers' defaults to '--cpus*2'. SetDefaults is called after parsing and before validation, nested structs first.
+type FlagDefaulter interface {
+	SetDefaults(set SetFlags)
+}
+
+// FlagNormalizer is implemented by a flags struct, or a nested flags struct, to normalize its values.
+// Normalize is called after SetDefaults, an error is reported like an invalid flag.
+type FlagNormalizer interface {
+	Normalize(set SetFlags) error
+}
+
+// flagHook is a flags struct that implements FlagDefaulter or FlagNormalizer
+type flagHook struct {
+	prefix string
+	focus  reflect.Value
+}
+
+// setFlags returns the flags that were set on the command line, by the environment or in a config file
+func (c *flagCollector) setFlags() SetFlags {
+	set := SetFlags{}
+	c.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, f := range c.flags {
+		if f.source.Kind == FromEnv || f.source.Kind == FromConfig {
+			set[f.name] = true
+		}
+	}
+	return set
+}
+
+// runHooks calls SetDefaults and Normalize on the flags structs, 'positionals' are the arguments filled by fillPositionalArgs
+func (c *flagCollector) runHooks(positionals map[string]int) error {
+	if len(c.hooks) == 0 {
+		return nil
+	}
+	set := c.setFlags()
+	for _, f := range c.flags {
+		if _, ok := positionals[f.positional]; ok && f.positional != "" {
+			set[f.name] = true
+		}
+	}
+	for _, h := range c.hooks {
+		scoped := set.scope(h.prefix)
+		if d, ok := h.focus.Interface().(FlagDefaulter); ok {
+			d.SetDefaults(scoped)
+		}
+		if n, ok := h.focus.Interface().(FlagNormalizer); ok {
+			if err := n.Normalize(scoped); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package struct_flags
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+type poolFlags struct {
+	CPUs    int `flag:"cpus"`
+	Workers int `flag:"workers"`
+}
+
+func (p *poolFlags) SetDefaults(set SetFlags) {
+	if !set.IsSet("workers") {
+		p.Workers = p.CPUs * 2
+	}
+}
+
+type buildFlags struct {
+	Input  string    `flag:"<input>"`
+	Out    string    `flag:"out"`
+	Format string    `flag:"format" env:"TEST_BUILD_FORMAT"`
+	Pool   poolFlags `flag:"pool"`
+	set    SetFlags
+}
+
+func (b *buildFlags) SetDefaults(set SetFlags) {
+	b.set = set
+	if b.Out == "" {
+		b.Out = b.Input + ".out"
+	}
+}
+
+func (b *buildFlags) Normalize(set SetFlags) error {
+	b.Format = strings.ToLower(b.Format)
+	if b.Format != "" && b.Format != "json" && b.Format != "text" {
+		return errors.New("unsupported format \"" + b.Format + "\"")
+	}
+	return nil
+}
+
+func TestFlagHooks(t *testing.T) {
+	var result buildFlags
+	command := NewCommand("build <input>", buildFlags{Pool: poolFlags{CPUs: 2}}, "", func(_ context.Context, f buildFlags) error {
+		result = f
+		return nil
+	})
+
+	require.NoError(t, Commands{command}.Run(context.TODO(), []string{"<exe>", "build", "--format=JSON", "main.go"}))
+	assert.Equal(t, "main.go.out", result.Out)
+	assert.Equal(t, "json", result.Format)
+	assert.Equal(t, 4, result.Pool.Workers)
+	assert.Equal(t, SetFlags{"format": true, "input": true}, result.set)
+
+	require.NoError(t, Commands{command}.Run(context.TODO(), []string{"<exe>", "build", "--pool.cpus=3", "--out=x", "main.go"}))
+	assert.Equal(t, "x", result.Out)
+	assert.Equal(t, 6, result.Pool.Workers)
+	assert.True(t, result.set.IsSet("pool.cpus"))
+
+	require.NoError(t, Commands{command}.Run(context.TODO(), []string{"<exe>", "build", "--pool.workers=1", "main.go"}))
+	assert.Equal(t, 1, result.Pool.Workers)
+
+	err := Commands{command}.Run(context.TODO(), []string{"<exe>", "build", "--format=xml", "main.go"})
+	require.EqualError(t, err, "unsupported format \"xml\"")
+}
+
+func TestFlagHooks_Env(t *testing.T) {
+	require.NoError(t, os.Setenv("TEST_BUILD_FORMAT", "TEXT"))
+	defer os.Unsetenv("TEST_BUILD_FORMAT")
+
+	var flags buildFlags
+	_, err := NewFlagSet("", buildFlags{}).UnmarshalFlags([]string{}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, "text", flags.Format)
+	assert.Equal(t, SetFlags{"format": true}, flags.set)
+}
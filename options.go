@@ -0,0 +1,61 @@
+package struct_flags
+
+import "context"
+
+// Options configure how a Commands tree is run, see WithOptions
+type Options struct {
+	// PrefixMatching selects a command by an unambiguous prefix of its name or one of its aliases
+	PrefixMatching bool
+	// GlobalFlags is a prefilled instance of a struct type for flags accepted anywhere in the arguments,
+	// before or after the command path. See GetGlobalFlags.
+	GlobalFlags interface{}
+	// RootFlags is a prefilled instance of a struct type for flags before the first command name,
+	// eg. 'my_util --chdir=/tmp print-args'. See GetRootFlags.
+	RootFlags interface{}
+	// LenientEnv ignores environment variables with invalid values, instead of failing
+	LenientEnv bool
+	// EnvPrefix starts the environment variable names derived from flag names, eg. MY_UTIL_NESTED_STRING1 for -nested.string1.
+	// Names are derived for fields with the tag `env:"auto"`, or for every field with AutoEnv.
+	EnvPrefix string
+	// AutoEnv derives an environment variable name for every field without an env tag
+	AutoEnv bool
+	// EnvCommandScope adds the command path to derived names, eg. MY_UTIL_PRINT_ARGS_NESTED_STRING1
+	EnvCommandScope bool
+	// EnvFiles reads the value of every environment variable from the file named by <NAME>_FILE, when it is set.
+	// A single field can opt in with the flag tag option 'envfile', eg. `flag:"db-password,envfile" env:"DB_PASSWORD"`.
+	EnvFiles bool
+	// ConfigFiles are read in order, a later file overrides an earlier one. The format is chosen by the extension:
+	// .json, .yaml, .yml or .toml. Keys are flag names, eg. 'nested.string1' or 'nested: {string1: ...}', and
+	// the flags of a command are in a section for its path, eg. 'cluster: {nodes: {list: {wide: true}}}'.
+	// Values from the environment and the command line take precedence.
+	ConfigFiles []string
+	// ConfigName finds the config files of the app, eg. "my_util" reads config.json, .yaml, .yml or .toml from /etc/my_util/
+	// and $XDG_CONFIG_HOME/my_util/, then my_util.json, .yaml, .yml or .toml from the working directory. A later file
+	// overrides an earlier one. The environment variable MY_UTIL_CONFIG, a list separated by os.PathListSeparator, replaces the found files.
+	// See GetConfigFiles.
+	ConfigName string
+	// ConfigFlag adds the root flag --config, that replaces the found config files and can be repeated
+	ConfigFlag bool
+	// Profiles adds the root flag --profile, eg. '--profile=prod', or the environment variable MY_UTIL_PROFILE, named from
+	// ConfigName or EnvPrefix, that selects a profile of the config files and argfiles. A profile can extend another profile,
+	// eg. 'profiles: {base: {...}, prod: {extends: base, ...}}', and overrides the values of its file. See GetProfile.
+	Profiles bool
+	// ExportArgFileEnv sets the "env" of argfiles in the process environment too. Otherwise they are only read for the
+	// invocation, by the flags and $var in the args, and commands can start child processes with Environ(ctx).
+	ExportArgFileEnv bool
+}
+
+var optionsKey = contextKey{value: 4}
+
+// WithOptions returns a context for Commands.Run, that applies the options to the whole Commands tree
+func WithOptions(ctx context.Context, options Options) context.Context {
+	return context.WithValue(ctx, optionsKey, options)
+}
+
+func getOptions(ctx context.Context) Options {
+	value := ctx.Value(optionsKey)
+	if value == nil {
+		return Options{}
+	}
+	return value.(Options)
+}
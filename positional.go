@@ -0,0 +1,219 @@
+package struct_flags
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// positionalArg is an argument in a command spec, eg. 'cp <src>... <dst>'.
+// '<name>' is required, '[name]' is optional and a trailing '...' accepts any number of arguments.
+type positionalArg struct {
+	name     string
+	required bool
+	variadic bool
+}
+
+func parsePositionalArg(spec string) (positionalArg, bool) {
+	var p positionalArg
+	if strings.HasSuffix(spec, "...") {
+		p.variadic = true
+		spec = strings.TrimSuffix(spec, "...")
+	}
+	if len(spec) < 3 {
+		return p, false
+	}
+	switch {
+	case spec[0] == '<' && spec[len(spec)-1] == '>':
+		p.required = true
+	case spec[0] == '[' && spec[len(spec)-1] == ']':
+	default:
+		return p, false
+	}
+	p.name = spec[1 : len(spec)-1]
+	if strings.HasSuffix(p.name, "...") {
+		p.variadic = true
+		p.name = strings.TrimSuffix(p.name, "...")
+	}
+	if p.name == "" || strings.ContainsAny(p.name, "<>[] ") {
+		return p, false
+	}
+	return p, true
+}
+
+// remainingArgsSpec ends a command spec that accepts more arguments than its positional arguments, eg. 'exec <name> ...'.
+// The arguments are returned by GetRemainingArgs.
+const remainingArgsSpec = "..."
+
+// acceptsRemainingArgs reports whether a command spec ends with '...', or declares no positional arguments
+func acceptsRemainingArgs(specs []string) bool {
+	return len(specs) == 0 || specs[len(specs)-1] == remainingArgsSpec
+}
+
+// parsePositionalArgs reads Command.PositionalArgs(), a bare name is treated as an optional argument
+func parsePositionalArgs(specs []string) []positionalArg {
+	var positionals []positionalArg
+	for _, spec := range specs {
+		if spec == remainingArgsSpec {
+			continue
+		}
+		p, ok := parsePositionalArg(spec)
+		if !ok {
+			p = positionalArg{name: spec}
+		}
+		positionals = append(positionals, p)
+	}
+	return positionals
+}
+
+func (p positionalArg) String() string {
+	s := "[" + p.name + "]"
+	if p.required {
+		s = "<" + p.name + ">"
+	}
+	if p.variadic {
+		s += "..."
+	}
+	return s
+}
+
+// readPositionalArg returns the name of the positional argument in a tag, eg. `flag:"[name]"` or `flag:"<name>"`
+func readPositionalArg(arg string) string {
+	p, ok := parsePositionalArg(arg)
+	if !ok {
+		return ""
+	}
+	return p.name
+}
+
+// describePositionalArg returns the spec of a positional argument as written in the command spec
+func describePositionalArg(specs []string, name string) string {
+	for _, p := range parsePositionalArgs(specs) {
+		if p.name == name {
+			return p.String()
+		}
+	}
+	return "[" + name + "]"
+}
+
+// positionalFields finds the fields bound to positional arguments, including those of nested, squashed and embedded structs
+func positionalFields(value reflect.Value, fields map[string]reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		info, ok := readFlagInfo(value.Type(), "", i)
+		if !ok {
+			continue
+		}
+		field := value.Field(i)
+		if info.positional != "" {
+			if _, ok := fields[info.positional]; ok {
+				return flagConfigError{err: "the positional argument '" + info.positional + "' is bound to more than one field", v: value}
+			}
+			fields[info.positional] = field
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			if err := positionalFields(field, fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fillPositionalArgs sets the fields bound to positional arguments from the arguments after the flags,
+// a variadic argument takes all arguments that are not needed by the positional arguments following it.
+// The names of the arguments that were set are added to 'filled', with the index of their first argument.
+// Extra arguments are an error, unless the command accepts remaining arguments, see acceptsRemainingArgs.
+func fillPositionalArgs(positionalArgs []string, value reflect.Value, argsAfterFlags []string, filled map[string]int) ([]string, error) {
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		panic("expected *struct{}, got: " + value.String())
+	}
+	positionals := parsePositionalArgs(positionalArgs)
+	bound := map[string]reflect.Value{}
+	if err := positionalFields(value.Elem(), bound); err != nil {
+		return nil, err
+	}
+	fields := make([]reflect.Value, len(positionals))
+	variadic := -1
+	for i, p := range positionals {
+		field, ok := bound[p.name]
+		if !ok {
+			return nil, flagConfigError{err: "no field has the tag `flag:\"" + p.String() + "\"`", v: value}
+		}
+		t := field.Type()
+		if p.variadic || (t.Kind() == reflect.Slice && !isScalar(t)) {
+			if variadic != -1 {
+				return nil, flagConfigError{err: "only one variadic positional argument is allowed, got " + positionals[variadic].String() + " and " + p.String(), v: value}
+			}
+			if t.Kind() != reflect.Slice {
+				return nil, flagConfigError{err: "variadic positional argument " + p.String() + " must be a slice", v: value}
+			}
+			variadic = i
+			t = t.Elem()
+		}
+		if !isScalar(t) {
+			return nil, flagConfigError{err: "unsupported type " + field.Type().String() + " for positional argument " + p.String(), v: value}
+		}
+		fields[i] = field
+	}
+
+	args := argsAfterFlags
+	end := len(args)
+	if variadic != -1 {
+		// positional arguments after the variadic one take the last arguments
+		end -= len(positionals) - variadic - 1
+	}
+	pos := 0
+	for i, p := range positionals {
+		switch {
+		case i == variadic:
+			var values []string
+			if pos < end {
+				values = args[pos:end]
+				pos = end
+			}
+			if err := setVariadicPositional(fields[i], p, values); err != nil {
+				return nil, err
+			}
+			if len(values) > 0 {
+				filled[p.name] = pos - len(values)
+			}
+		case pos < len(args):
+			if err := setPositional(fields[i], p, args[pos]); err != nil {
+				return nil, err
+			}
+			filled[p.name] = pos
+			pos++
+		case p.required:
+			return nil, fmt.Errorf("missing argument <%s>", p.name)
+		}
+	}
+	if pos < len(args) && !acceptsRemainingArgs(positionalArgs) {
+		return nil, fmt.Errorf("unexpected argument \"%s\"", args[pos])
+	}
+	return args[pos:], nil
+}
+
+func setPositional(field reflect.Value, p positionalArg, arg string) error {
+	if err := setScalar(field, arg); err != nil {
+		return fmt.Errorf("invalid value \"%s\" for argument %s: %s", arg, p.String(), err.Error())
+	}
+	return nil
+}
+
+func setVariadicPositional(field reflect.Value, p positionalArg, args []string) error {
+	if len(args) == 0 {
+		if p.required {
+			return fmt.Errorf("missing argument <%s>", p.name)
+		}
+		return nil
+	}
+	values := reflect.MakeSlice(field.Type(), len(args), len(args))
+	for i, arg := range args {
+		if err := setPositional(values.Index(i), p, arg); err != nil {
+			return err
+		}
+	}
+	field.Set(values)
+	return nil
+}
@@ -0,0 +1,163 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCommand_TypedPositionalArgs(t *testing.T) {
+
+	type cmd struct {
+		Count   int           `flag:"<count>"`
+		Timeout time.Duration `flag:"[timeout]"`
+		IP      net.IP        `flag:"[ip]"`
+	}
+
+	var result cmd
+
+	command := NewCommand("cmd <count> [timeout] [ip]", cmd{Timeout: time.Second}, "", func(_ context.Context, flags cmd) error {
+		result = flags
+		return nil
+	})
+
+	commands := Commands{command}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd", "3", "1m", "127.0.0.1"}))
+	assert.Equal(t, cmd{Count: 3, Timeout: time.Minute, IP: net.ParseIP("127.0.0.1")}, result)
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd", "3", "1m", "127.0.0.1", "b"}), "unexpected argument \"b\"")
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd", "4"}))
+	assert.Equal(t, cmd{Count: 4, Timeout: time.Second}, result)
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd"}), "missing argument <count>")
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cmd", "three"}), "invalid value \"three\" for argument <count>: parse error")
+}
+
+func TestCommand_VariadicPositionalArgs(t *testing.T) {
+
+	type cmd struct {
+		Src []string `flag:"<src>"`
+		Dst string   `flag:"<dst>"`
+	}
+
+	var result cmd
+
+	command := NewCommand("cp <src>... <dst>", cmd{}, "", func(_ context.Context, flags cmd) error {
+		result = flags
+		return nil
+	})
+
+	commands := Commands{command}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "cp", "a", "b", "c"}))
+	assert.Equal(t, cmd{Src: []string{"a", "b"}, Dst: "c"}, result)
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cp", "a"}), "missing argument <src>")
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "cp"}), "missing argument <src>")
+}
+
+func TestCommand_RemainingArgs(t *testing.T) {
+
+	type cmd struct {
+		Name string `flag:"<name>"`
+	}
+
+	var result cmd
+	var remaining []string
+
+	command := NewCommand("exec <name> ...", cmd{}, "", func(ctx context.Context, flags cmd) error {
+		result = flags
+		remaining = GetRemainingArgs(ctx)
+		return nil
+	})
+
+	commands := Commands{command}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "exec", "a", "b", "--c"}))
+	assert.Equal(t, cmd{Name: "a"}, result)
+	assert.Equal(t, []string{"b", "--c"}, remaining)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "exec", "a"}))
+	assert.Empty(t, remaining)
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "exec"}), "missing argument <name>")
+
+	invalid := NewCommand("exec ... <name>", cmd{}, "", func(_ context.Context, flags cmd) error { return nil })
+	assert.PanicsWithValue(t, "invalid positional args: exec ... <name>", func() { invalid.PositionalArgs() })
+}
+
+func TestParsePositionalArg(t *testing.T) {
+
+	p, ok := parsePositionalArg("<src>...")
+	require.True(t, ok)
+	assert.Equal(t, positionalArg{name: "src", required: true, variadic: true}, p)
+
+	p, ok = parsePositionalArg("[src...]")
+	require.True(t, ok)
+	assert.Equal(t, positionalArg{name: "src", variadic: true}, p)
+	assert.Equal(t, "[src]...", p.String())
+
+	_, ok = parsePositionalArg("src")
+	assert.False(t, ok)
+
+	_, ok = parsePositionalArg("[]")
+	assert.False(t, ok)
+}
+
+type Target struct {
+	Target string `flag:"<target>" validate:"required"`
+	DryRun bool   `flag:"dry-run"`
+}
+
+func TestCommand_NestedPositionalArgs(t *testing.T) {
+
+	type deploy struct {
+		Target
+		Replicas int `flag:"[replicas]"`
+	}
+
+	type destroy struct {
+		Shared Target `flag:"-"`
+		Force  bool   `flag:"force"`
+	}
+
+	var deployed deploy
+	var destroyed destroy
+
+	commands := Commands{
+		NewCommand("deploy <target> [replicas]", deploy{Replicas: 1}, "", func(_ context.Context, flags deploy) error {
+			deployed = flags
+			return nil
+		}),
+		NewCommand("destroy <target>", destroy{}, "", func(_ context.Context, flags destroy) error {
+			destroyed = flags
+			return nil
+		}),
+	}
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "deploy", "--dry-run", "prod"}))
+	assert.Equal(t, deploy{Target: Target{Target: "prod", DryRun: true}, Replicas: 1}, deployed)
+
+	require.NoError(t, commands.Run(context.TODO(), []string{"<exe>", "destroy", "--force", "--dry-run", "dev"}))
+	assert.Equal(t, destroy{Shared: Target{Target: "dev", DryRun: true}, Force: true}, destroyed)
+
+	assert.EqualError(t, commands.Run(context.TODO(), []string{"<exe>", "destroy"}), "missing argument <target>")
+
+	type duplicate struct {
+		Target
+		Other string `flag:"[target]"`
+	}
+
+	require.Panics(t, func() {
+		_ = Commands{NewCommand("duplicate <target>", duplicate{}, "", func(_ context.Context, _ duplicate) error {
+			return nil
+		})}.Run(context.TODO(), []string{"<exe>", "duplicate", "a"})
+	})
+}
@@ -0,0 +1,243 @@
+package struct_flags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	profileFlagName = "profile"
+	// profilesKey is the key of the profiles in a config file
+	profilesKey = "profiles"
+	// extendsKey is the key of the profile that a profile extends
+	extendsKey = "extends"
+)
+
+// ArgFileProfile is a named profile of an ArgFile, see Options.Profiles
+type ArgFileProfile struct {
+	// Extends is the name of a profile that is applied first
+	Extends string `json:"extends" yaml:"extends" toml:"extends"`
+	// Command replaces the command of the ArgFile, if it is set
+	Command []string `json:"command" yaml:"command" toml:"command"`
+	// Args are added after the arguments of the ArgFile
+	Args []string `json:"args" yaml:"args" toml:"args"`
+	// Env is applied after the environment of the ArgFile
+	Env []string `json:"env" yaml:"env" toml:"env"`
+	// file is the argfile of the profile, that can be an included file
+	file string
+}
+
+// profile is the profile selected for the Commands tree, it records the profiles found in config files and argfiles
+type profile struct {
+	name      string
+	found     bool
+	available map[string]bool
+}
+
+var profileKey = contextKey{value: 11}
+
+// GetProfile returns the selected profile, or "" if none was selected, see Options.Profiles
+func GetProfile(ctx context.Context) string {
+	if p := getProfile(ctx); p != nil {
+		return p.name
+	}
+	return ""
+}
+
+func getProfile(ctx context.Context) *profile {
+	p, _ := ctx.Value(profileKey).(*profile)
+	return p
+}
+
+// profileEnvName returns the environment variable that selects a profile, eg. MY_UTIL_PROFILE
+func profileEnvName(options Options) string {
+	name := options.ConfigName
+	if name == "" {
+		name = options.EnvPrefix
+	}
+	if name == "" {
+		return ""
+	}
+	return envName(name, profileFlagName)
+}
+
+// selectProfile returns the profile of the last --profile flag, or the environment, or nil if none was selected
+func selectProfile(options Options, flagProfiles []string) *profile {
+	if !options.Profiles {
+		return nil
+	}
+	name := ""
+	if len(flagProfiles) > 0 {
+		name = flagProfiles[len(flagProfiles)-1]
+	} else if env := profileEnvName(options); env != "" {
+		name = os.Getenv(env)
+	}
+	if name == "" {
+		return nil
+	}
+	return &profile{name: name, available: map[string]bool{}}
+}
+
+// add records the profiles of a config file or argfile, and reports whether the selected profile is one of them
+func (p *profile) add(names []string) bool {
+	if p == nil {
+		return false
+	}
+	for _, name := range names {
+		p.available[name] = true
+		if name == p.name {
+			p.found = true
+		}
+	}
+	return p.available[p.name]
+}
+
+// check returns an error if the selected profile is not in any of the config files or the argfile
+func (p *profile) check() error {
+	if p == nil || p.found {
+		return nil
+	}
+	if len(p.available) == 0 {
+		return fmt.Errorf("unknown profile \"%s\", no profiles are defined", p.name)
+	}
+	var names []string
+	for name := range p.available {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown profile \"%s\", available profiles: %s", p.name, strings.Join(names, ", "))
+}
+
+// profileChain returns the profile and the profiles it extends, in the order they are applied, eg. [base prod].
+// 'extends' returns the profile that a profile extends, and false if the profile does not exist.
+func profileChain(name string, extends func(name string) (string, bool, error)) ([]string, error) {
+	var path []string
+	seen := map[string]bool{}
+	for n := name; n != ""; {
+		if seen[n] {
+			return nil, fmt.Errorf("profile \"%s\" extends itself: %s -> %s", n, strings.Join(path, " -> "), n)
+		}
+		seen[n] = true
+		parent, ok, err := extends(n)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("profile \"%s\" extends an unknown profile \"%s\"", path[len(path)-1], n)
+		}
+		path = append(path, n)
+		n = parent
+	}
+	chain := make([]string, len(path))
+	for i, n := range path {
+		chain[len(path)-1-i] = n
+	}
+	return chain, nil
+}
+
+// applyProfile takes the profiles out of the config files. The values of the selected profile, after the profiles it extends,
+// follow the values of its file, to override them.
+func applyProfile(files []configFile, p *profile) ([]configFile, error) {
+	var applied []configFile
+	for _, f := range files {
+		values := map[string]interface{}{}
+		for k, v := range f.values {
+			if k != profilesKey {
+				values[k] = v
+			}
+		}
+		applied = append(applied, configFile{name: f.name, key: f.key, values: values})
+		raw, ok := f.values[profilesKey]
+		if !ok {
+			continue
+		}
+		profiles, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid value for key %s in config file %s: expected a map of profiles", profilesKey, f.name)
+		}
+		if !p.add(sortedConfigKeys(profiles)) {
+			continue
+		}
+		chain, err := profileChain(p.name, func(name string) (string, bool, error) {
+			raw, ok := profiles[name]
+			if !ok {
+				return "", false, nil
+			}
+			values, ok := raw.(map[string]interface{})
+			if !ok {
+				return "", true, fmt.Errorf("invalid value for key %s.%s in config file %s: expected a map", profilesKey, name, f.name)
+			}
+			extends, ok := values[extendsKey].(string)
+			if _, isSet := values[extendsKey]; isSet && !ok {
+				return "", true, fmt.Errorf("invalid value for key %s.%s.%s in config file %s: expected the name of a profile", profilesKey, name, extendsKey, f.name)
+			}
+			return extends, true, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s, in config file %s", err.Error(), f.name)
+		}
+		for _, name := range chain {
+			applied = append(applied, profileFile(f.name, name, profiles[name].(map[string]interface{})))
+		}
+	}
+	return applied, nil
+}
+
+// profileFiles returns every profile of the config files, to check their keys
+func profileFiles(files []configFile) []configFile {
+	var found []configFile
+	for _, f := range files {
+		profiles, _ := f.values[profilesKey].(map[string]interface{})
+		for _, name := range sortedConfigKeys(profiles) {
+			if values, ok := profiles[name].(map[string]interface{}); ok {
+				found = append(found, profileFile(f.name, name, values))
+			}
+		}
+	}
+	return found
+}
+
+func profileFile(filename, name string, profile map[string]interface{}) configFile {
+	values := map[string]interface{}{}
+	for k, v := range profile {
+		if k != extendsKey {
+			values[k] = v
+		}
+	}
+	return configFile{name: filename, key: profilesKey + "." + name + ".", values: values}
+}
+
+// withProfile returns the ArgFile with the selected profile applied, and the sources of its arguments
+func (a ArgFile) withProfile(p *profile, filename string) (ArgFile, []Source, error) {
+	applied := ArgFile{Command: a.Command, Args: a.Args, Env: a.Env}
+	sources := append([]Source{}, a.sources...)
+	var names []string
+	for name := range a.Profiles {
+		names = append(names, name)
+	}
+	if !p.add(names) {
+		return applied, sources, nil
+	}
+	chain, err := profileChain(p.name, func(name string) (string, bool, error) {
+		profile, ok := a.Profiles[name]
+		return profile.Extends, ok, nil
+	})
+	if err != nil {
+		return applied, nil, fmt.Errorf("%s, in @argfile %s", err.Error(), filename)
+	}
+	for _, name := range chain {
+		profile := a.Profiles[name]
+		if len(profile.Command) > 0 {
+			applied.Command = profile.Command
+		}
+		applied.Args = append(append([]string{}, applied.Args...), profile.Args...)
+		applied.Env = append(append([]string{}, applied.Env...), profile.Env...)
+		for i := range profile.Args {
+			sources = append(sources, Source{Kind: FromArgFile, Name: profile.file, Key: profilesKey + "." + name + ".args", Position: i})
+		}
+	}
+	return applied, sources, nil
+}
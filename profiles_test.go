@@ -0,0 +1,148 @@
+package struct_flags
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestProfiles_ConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := writeConfigFile(t, dir, "app.yaml", `
+serve:
+  name: file
+  level: file
+  nested:
+    port: 1
+profiles:
+  base:
+    serve:
+      level: base
+      nested:
+        host: base
+  prod:
+    extends: base
+    serve:
+      name: prod
+`)
+
+	var result configFlags
+	var sources Sources
+	var profile string
+	var files []string
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			result = f
+			sources = GetSources(ctx)
+			profile = GetProfile(ctx)
+			files = GetConfigFiles(ctx)
+			return nil
+		}),
+	}
+	ctx := WithOptions(context.TODO(), Options{ConfigFiles: []string{config}, ConfigName: "app", Profiles: true})
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "serve"}))
+	assert.Equal(t, "", profile)
+	assert.Equal(t, configFlags{Name: "file", Level: "file", Nested: configNested{Port: 1}}, result)
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--profile=prod", "serve"}))
+	assert.Equal(t, "prod", profile)
+	assert.Equal(t, []string{config}, files)
+	assert.Equal(t, configFlags{Name: "prod", Level: "base", Nested: configNested{Host: "base", Port: 1}}, result)
+	assert.Equal(t, Source{Kind: FromConfig, Name: config, Key: "profiles.prod.serve.name"}, sources["name"])
+	assert.Equal(t, Source{Kind: FromConfig, Name: config, Key: "profiles.base.serve.nested.host"}, sources["nested.host"])
+	assert.Equal(t, Source{Kind: FromConfig, Name: config, Key: "serve.nested.port"}, sources["nested.port"])
+
+	require.NoError(t, os.Setenv("APP_PROFILE", "base"))
+	defer os.Unsetenv("APP_PROFILE")
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "serve"}))
+	assert.Equal(t, "base", profile)
+	assert.Equal(t, configFlags{Name: "file", Level: "base", Nested: configNested{Host: "base", Port: 1}}, result)
+
+	// the flag is preferred to the environment
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--profile", "prod", "serve"}))
+	assert.Equal(t, "prod", profile)
+
+	require.EqualError(t, commands.Run(ctx, []string{"<exe>", "--profile=staging", "serve"}),
+		"unknown profile \"staging\", available profiles: base, prod")
+
+	err = commands.Run(ctx, []string{"<exe>", "help"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "-profile string\n    \tthe profile of the config files and argfiles (env \"APP_PROFILE\")")
+}
+
+func TestProfiles_ConfigFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			return nil
+		}),
+	}
+	run := func(config string, args ...string) error {
+		filename := writeConfigFile(t, dir, "app.yaml", config)
+		ctx := WithOptions(context.TODO(), Options{ConfigFiles: []string{filename}, Profiles: true})
+		return commands.Run(ctx, append([]string{"<exe>"}, args...))
+	}
+	filename := dir + "/app.yaml"
+
+	assert.EqualError(t, run("serve:\n  name: x\n", "--profile=prod", "serve"), "unknown profile \"prod\", no profiles are defined")
+	assert.EqualError(t, run("profiles:\n  a:\n    extends: b\n  b:\n    extends: a\n", "--profile=a", "serve"),
+		"profile \"a\" extends itself: a -> b -> a, in config file "+filename)
+	assert.EqualError(t, run("profiles:\n  a:\n    extends: b\n", "--profile=a", "serve"),
+		"profile \"a\" extends an unknown profile \"b\", in config file "+filename)
+	assert.EqualError(t, run("profiles:\n  a:\n    serve:\n      nme: x\n", "--profile=a", "serve"),
+		"unknown key \"profiles.a.serve.nme\" in config file "+filename+", did you mean \"profiles.a.serve.name\"?")
+	// the profiles that are not selected are checked too
+	assert.EqualError(t, run("profiles:\n  a:\n    serve:\n      nme: x\n", "serve"),
+		"unknown key \"profiles.a.serve.nme\" in config file "+filename+", did you mean \"profiles.a.serve.name\"?")
+}
+
+func TestProfiles_ArgFile(t *testing.T) {
+	argFile, err := ioutil.TempFile("", t.Name()+"-argfile.json")
+	require.NoError(t, err)
+	defer os.Remove(argFile.Name())
+	data, _ := json.Marshal(ArgFile{
+		Command: []string{"serve"},
+		Args:    []string{"--name=file"},
+		Profiles: map[string]ArgFileProfile{
+			"base": {Args: []string{"--nested.host=base"}},
+			"prod": {Extends: "base", Args: []string{"--level=prod"}, Env: []string{"TEST_PROFILE_ENV=prod"}},
+		},
+	})
+	_, err = argFile.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, argFile.Close())
+
+	var result configFlags
+	var sources Sources
+	var env string
+	commands := Commands{
+		NewCommand("serve", configFlags{}, "", func(ctx context.Context, f configFlags) error {
+			result = f
+			sources = GetSources(ctx)
+			env, _ = LookupEnv(ctx, "TEST_PROFILE_ENV")
+			return nil
+		}),
+	}
+	ctx := WithOptions(context.TODO(), Options{Profiles: true})
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "--profile=prod", "@" + argFile.Name(), "--nested.port=1"}))
+	assert.Equal(t, configFlags{Name: "file", Level: "prod", Nested: configNested{Host: "base", Port: 1}}, result)
+	assert.Equal(t, "prod", env)
+	assert.Equal(t, Source{Kind: FromArgFile, Name: argFile.Name(), Key: "profiles.prod.args"}, sources["level"])
+	assert.Equal(t, "argfile "+argFile.Name()+", profiles.base.args[0]", sources["nested.host"].String())
+	assert.Equal(t, Source{Kind: FromArgFile, Name: argFile.Name()}, sources["name"])
+
+	require.EqualError(t, commands.Run(ctx, []string{"<exe>", "--profile=dev", "@" + argFile.Name()}),
+		"unknown profile \"dev\", available profiles: base, prod")
+}
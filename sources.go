@@ -0,0 +1,143 @@
+package struct_flags
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+type SourceKind int
+
+const (
+	// FromDefault is a value of the prefilled flags struct
+	FromDefault SourceKind = iota
+	// FromDefaultTag is a value of the `default:"..."` tag
+	FromDefaultTag
+	// FromConfig is a value of a config file, see Options.ConfigFiles
+	FromConfig
+	// FromEnv is a value of an environment variable
+	FromEnv
+	// FromArgFile is an argument in the "args" of an @argfile
+	FromArgFile
+	// FromCommandLine is an argument on the command line
+	FromCommandLine
+)
+
+// Source is where the value of a flag, or positional argument, was read from
+type Source struct {
+	Kind SourceKind
+	// Name is the environment variable for FromEnv, or the path of the argfile, or config file, for FromArgFile and FromConfig
+	Name string
+	// Position is the index of the argument in the argfile's "args", or in the list named by Key, for FromArgFile
+	Position int
+	// Key is the key in the config file for FromConfig, or the list of a profile in the argfile for FromArgFile, eg. "profiles.prod.args"
+	Key string
+}
+
+// String describes the source, eg. 'env MY_UTIL_PORT', 'config file my_util.yaml, key serve.port' or 'argfile args.json, args[2]'
+func (s Source) String() string {
+	switch s.Kind {
+	case FromDefault:
+		return "default"
+	case FromDefaultTag:
+		return "default tag"
+	case FromConfig:
+		return fmt.Sprintf("config file %s, key %s", s.Name, s.Key)
+	case FromEnv:
+		return "env " + s.Name
+	case FromArgFile:
+		if s.Key != "" {
+			return fmt.Sprintf("argfile %s, %s[%d]", s.Name, s.Key, s.Position)
+		}
+		return fmt.Sprintf("argfile %s, args[%d]", s.Name, s.Position)
+	case FromCommandLine:
+		return "command line"
+	default:
+		return fmt.Sprintf("unknown source %d", s.Kind)
+	}
+}
+
+// Sources maps the name of each flag, eg. "nested.string1", or positional argument, eg. "dir", to the source of its value
+type Sources map[string]Source
+
+var sourcesKey = contextKey{value: 8}
+
+// GetSources returns the sources of the values of the command's flags, for the context passed to the command
+func GetSources(ctx context.Context) Sources {
+	sources, _ := ctx.Value(sourcesKey).(Sources)
+	return sources
+}
+
+func withSources(ctx context.Context, sources Sources) context.Context {
+	return context.WithValue(ctx, sourcesKey, sources)
+}
+
+var argSourcesKey = contextKey{value: 9}
+
+// getArgSources returns the sources of the last arguments, the other arguments are from the command line
+func getArgSources(ctx context.Context) []Source {
+	sources, _ := ctx.Value(argSourcesKey).([]Source)
+	return sources
+}
+
+func withArgSources(ctx context.Context, sources []Source) context.Context {
+	return context.WithValue(ctx, argSourcesKey, sources)
+}
+
+// tailSources returns the sources of the last n arguments
+func tailSources(sources []Source, n int) []Source {
+	tail := make([]Source, n)
+	for i := range tail {
+		tail[i] = Source{Kind: FromCommandLine}
+	}
+	if len(sources) > n {
+		sources = sources[len(sources)-n:]
+	}
+	copy(tail[n-len(sources):], sources)
+	return tail
+}
+
+// describeSource is added to messages about a value that was not given on the command line, eg. ' (from env PORT)'
+func describeSource(sources Sources, name string) string {
+	source, ok := sources[name]
+	if !ok || source.Kind == FromCommandLine {
+		return ""
+	}
+	return " (from " + source.String() + ")"
+}
+
+// Sources returns the sources of the values of the last UnmarshalFlags
+func (s flagSet) Sources() Sources {
+	return s.sources
+}
+
+// setSources records the default, environment variable or argument of each flag, 'args' are the arguments that were parsed
+func (s flagSet) setSources(c *flagCollector, args []string) {
+	for name := range s.sources {
+		delete(s.sources, name)
+	}
+	for _, f := range c.flags {
+		s.sources[f.name] = f.source
+	}
+	argSources := tailSources(s.argSources, len(args))
+	// the last argument of a flag sets its value
+	scanFlags(c.fs, nil, args[:len(args)-len(c.fs.Args())], func(f *flag.Flag, i, _ int) {
+		s.sources[f.Name] = argSources[i]
+	})
+}
+
+// addPositionalSources records the arguments of the positional arguments filled by fillPositionalArgs,
+// 'afterFlags' is the index of the first argument after the flags
+func (s flagSet) addPositionalSources(c *flagCollector, filled map[string]int, afterFlags int) {
+	for _, f := range c.flags {
+		i, ok := filled[f.positional]
+		if !ok || f.positional == "" {
+			continue
+		}
+		source := Source{Kind: FromCommandLine}
+		if afterFlags+i < len(s.argSources) {
+			source = s.argSources[afterFlags+i]
+		}
+		s.sources[f.name] = source
+	}
+}
@@ -0,0 +1,86 @@
+package struct_flags
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type sourcesNested struct {
+	Host string `flag:"host"`
+	Port int    `flag:"port" validate:"min=1"`
+}
+
+type sourcesFlags struct {
+	Dir     string        `flag:"<dir>"`
+	Name    string        `flag:"name"`
+	Level   string        `flag:"level" env:"TEST_SOURCES_LEVEL"`
+	Timeout string        `flag:"timeout" default:"1m"`
+	Nested  sourcesNested `flag:"nested"`
+}
+
+func TestSources(t *testing.T) {
+	require.NoError(t, os.Setenv("TEST_SOURCES_LEVEL", "debug"))
+	defer os.Unsetenv("TEST_SOURCES_LEVEL")
+
+	type Globals struct {
+		Verbose bool `flag:"verbose"`
+	}
+
+	var sources Sources
+	command := NewCommand("serve <dir>", sourcesFlags{Nested: sourcesNested{Port: 80}}, "", func(ctx context.Context, _ sourcesFlags) error {
+		sources = GetSources(ctx)
+		return nil
+	})
+	commands := Commands{command}
+	ctx := WithOptions(context.TODO(), Options{GlobalFlags: Globals{}})
+
+	argFile, err := ioutil.TempFile("", t.Name()+"-argfile.json")
+	require.NoError(t, err)
+	defer os.Remove(argFile.Name())
+	data, _ := json.Marshal(ArgFile{
+		Command: []string{"serve"},
+		Args:    []string{"--verbose", "--nested.host=h", "--name=file"},
+	})
+	_, err = argFile.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, argFile.Close())
+
+	require.NoError(t, commands.Run(ctx, []string{"<exe>", "@" + argFile.Name(), "--name=cli", "dir"}))
+	assert.Equal(t, Sources{
+		"dir":         {Kind: FromCommandLine},
+		"name":        {Kind: FromCommandLine},
+		"level":       {Kind: FromEnv, Name: "TEST_SOURCES_LEVEL"},
+		"timeout":     {Kind: FromDefaultTag},
+		"nested.host": {Kind: FromArgFile, Name: argFile.Name(), Position: 1},
+		"nested.port": {Kind: FromDefault},
+	}, sources)
+
+	err = commands.Run(ctx, []string{"<exe>", "serve", "--nested.port=0", "dir"})
+	require.EqualError(t, err, "invalid value \"0\" for flag -nested.port: validation failed for rule 'min=1'")
+
+	data, _ = json.Marshal(ArgFile{
+		Command: []string{"serve"},
+		Args:    []string{"--nested.port=0", "dir"},
+	})
+	require.NoError(t, ioutil.WriteFile(argFile.Name(), data, 0600))
+	err = commands.Run(ctx, []string{"<exe>", "@" + argFile.Name()})
+	require.EqualError(t, err, "invalid value \"0\" for flag -nested.port (from argfile "+argFile.Name()+", args[0]): validation failed for rule 'min=1'")
+}
+
+func TestFlagSet_Sources(t *testing.T) {
+	require.NoError(t, os.Setenv("TEST_SOURCES_LEVEL", "debug"))
+	defer os.Unsetenv("TEST_SOURCES_LEVEL")
+
+	fs := NewFlagSet("", sourcesFlags{})
+	var flags sourcesFlags
+	_, err := fs.UnmarshalFlags([]string{"--name=a", "--nested.port", "1"}, &flags)
+	require.NoError(t, err)
+	assert.Equal(t, Source{Kind: FromCommandLine}, fs.(FlagSetSources).Sources()["nested.port"])
+	assert.Equal(t, Source{Kind: FromDefault}, fs.(FlagSetSources).Sources()["nested.host"])
+	assert.Equal(t, "env TEST_SOURCES_LEVEL", fs.(FlagSetSources).Sources()["level"].String())
+}
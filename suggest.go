@@ -0,0 +1,73 @@
+package struct_flags
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current := row[j]
+			row[j] = min3(row[j]+1, row[j-1]+1, prev+cost)
+			prev = current
+		}
+	}
+	return row[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggest returns the candidate closest to name, or "" if none are close enough to be a typo
+func suggest(name string, candidates []string) string {
+	maxDistance := len(name) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	best, bestDistance := "", maxDistance+1
+	for _, c := range candidates {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(c)); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+const undefinedFlagError = "flag provided but not defined: -"
+
+// suggestFlag adds the closest registered flag name to an undefined flag error
+func suggestFlag(fs *flag.FlagSet, err error) error {
+	if !strings.HasPrefix(err.Error(), undefinedFlagError) {
+		return err
+	}
+	name := strings.TrimPrefix(err.Error(), undefinedFlagError)
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	if suggestion := suggest(name, names); suggestion != "" {
+		return fmt.Errorf("%s, did you mean -%s?", err.Error(), suggestion)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package struct_flags
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+
+	assert.Equal(t, 0, levenshtein("print-args", "print-args"))
+	assert.Equal(t, 1, levenshtein("prnt-args", "print-args"))
+	assert.Equal(t, 3, levenshtein("", "abc"))
+
+	assert.Equal(t, "print-args", suggest("prnt-args", []string{"more", "print-args"}))
+	assert.Equal(t, "", suggest("xyz", []string{"more", "print-args"}))
+}
+
+func TestSuggest_Commands(t *testing.T) {
+
+	type cmd struct {
+		Filepath string `flag:"filepath"`
+		Nested   struct {
+			String1 string `flag:"string1"`
+		} `flag:"nested"`
+	}
+
+	command := NewCommand("print-args", cmd{}, "", func(_ context.Context, _ cmd) error {
+		return nil
+	})
+
+	commands := Commands{command, NewCommandGroup("more", "")}
+
+	err := commands.Run(context.TODO(), []string{"<exe>", "prnt-args"})
+	assert.True(t, strings.HasSuffix(err.Error(), "\nunknown command \"prnt-args\", did you mean \"print-args\"?"), err.Error())
+
+	err = commands.Run(context.TODO(), []string{"<exe>", "unrelated"})
+	assert.True(t, strings.HasSuffix(err.Error(), "\nunknown command \"unrelated\""), err.Error())
+
+	err = commands.Run(context.TODO(), []string{"<exe>", "help"})
+	assert.True(t, strings.HasSuffix(err.Error(), "\nflag: help requested"), err.Error())
+
+	err = commands.Run(context.TODO(), []string{"<exe>", "print-args", "--filepth=a"})
+	assert.EqualError(t, err, "flag provided but not defined: -filepth, did you mean -filepath?")
+
+	err = commands.Run(context.TODO(), []string{"<exe>", "print-args", "--nested.strin1=a"})
+	assert.EqualError(t, err, "flag provided but not defined: -nested.strin1, did you mean -nested.string1?")
+}
@@ -0,0 +1,277 @@
+package struct_flags
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// isScalar reports whether setScalar can parse a value of type t
+func isScalar(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) || t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setScalar parses s into the addressable value v, according to its type
+func setScalar(v reflect.Value, s string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return numError(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type().String())
+	}
+	return nil
+}
+
+var (
+	errParse = errors.New("parse error")
+	errRange = errors.New("value out of range")
+)
+
+// numError reports strconv errors like the flag package, as the input is reported by the caller
+func numError(err error) error {
+	ne, ok := err.(*strconv.NumError)
+	if !ok {
+		return err
+	}
+	switch ne.Err {
+	case strconv.ErrSyntax:
+		return errParse
+	case strconv.ErrRange:
+		return errRange
+	}
+	return ne.Err
+}
+
+// registerFlag registers a flag that parses into the addressable 'value', it returns false for unsupported types
+func registerFlag(fs *flag.FlagSet, name, usage string, value reflect.Value) bool {
+	// the flag package's own values are used where possible, for the type names in usage
+	switch p := value.Addr().Interface().(type) {
+	case flag.Value:
+		fs.Var(p, name, usage)
+	case *string:
+		fs.StringVar(p, name, *p, usage)
+	case *bool:
+		fs.BoolVar(p, name, *p, usage)
+	case *int:
+		fs.IntVar(p, name, *p, usage)
+	case *int64:
+		fs.Int64Var(p, name, *p, usage)
+	case *uint:
+		fs.UintVar(p, name, *p, usage)
+	case *uint64:
+		fs.Uint64Var(p, name, *p, usage)
+	case *float64:
+		fs.Float64Var(p, name, *p, usage)
+	case *time.Duration:
+		fs.DurationVar(p, name, *p, usage)
+	default:
+		t := value.Type()
+		switch {
+		case isScalar(t):
+			fs.Var(&scalarValue{v: value}, name, usage)
+		case t.Kind() == reflect.Slice && isScalar(t.Elem()):
+			fs.Var(&sliceValue{v: value}, name, usage)
+		case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && isScalar(t.Elem()):
+			fs.Var(&mapValue{v: value}, name, usage)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// setFlagValue sets the flag 'f', registered for 'value', to 's', and keeps the previous value if it fails to parse
+func setFlagValue(f *flag.Flag, value reflect.Value, s string) error {
+	previous := reflect.New(value.Type()).Elem()
+	previous.Set(value)
+	if err := f.Value.Set(s); err != nil {
+		// the flag package's values are changed even if they fail to parse
+		value.Set(previous)
+		return err
+	}
+	return nil
+}
+
+// scalarValue is a flag.Value for the types supported by setScalar
+type scalarValue struct {
+	v reflect.Value
+}
+
+func (s *scalarValue) String() string {
+	if !s.v.IsValid() {
+		return ""
+	}
+	return formatScalar(s.v)
+}
+
+func (s *scalarValue) Set(value string) error {
+	v := reflect.New(s.v.Type()).Elem()
+	if err := setScalar(v, value); err != nil {
+		return err
+	}
+	s.v.Set(v)
+	return nil
+}
+
+func (s *scalarValue) IsBoolFlag() bool {
+	return s.v.IsValid() && s.v.Kind() == reflect.Bool
+}
+
+func formatScalar(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// resettable values replace their value on the next Set, instead of adding to it
+type resettable interface {
+	reset()
+}
+
+// sliceValue is a flag.Value for slices, the value is split by ',' and each flag adds to the slice.
+// The first flag replaces the default.
+type sliceValue struct {
+	v     reflect.Value
+	added bool
+}
+
+func (s *sliceValue) String() string {
+	if !s.v.IsValid() {
+		return ""
+	}
+	var values []string
+	for i := 0; i < s.v.Len(); i++ {
+		values = append(values, formatScalar(s.v.Index(i)))
+	}
+	return strings.Join(values, ",")
+}
+
+func (s *sliceValue) Set(value string) error {
+	values := reflect.MakeSlice(s.v.Type(), 0, 0)
+	if s.added {
+		values = s.v
+	}
+	for _, e := range strings.Split(value, ",") {
+		v := reflect.New(s.v.Type().Elem()).Elem()
+		if err := setScalar(v, e); err != nil {
+			return err
+		}
+		values = reflect.Append(values, v)
+	}
+	s.v.Set(values)
+	s.added = true
+	return nil
+}
+
+func (s *sliceValue) reset() {
+	s.added = false
+}
+
+// mapValue is a flag.Value for maps with string keys, the value is a list of 'key=value' split by ','.
+// The first flag replaces the default.
+type mapValue struct {
+	v     reflect.Value
+	added bool
+}
+
+func (m *mapValue) String() string {
+	if !m.v.IsValid() {
+		return ""
+	}
+	var entries []string
+	for _, k := range m.v.MapKeys() {
+		entries = append(entries, k.String()+"="+formatScalar(m.v.MapIndex(k)))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (m *mapValue) Set(value string) error {
+	entries := reflect.MakeMap(m.v.Type())
+	if m.added {
+		for _, k := range m.v.MapKeys() {
+			entries.SetMapIndex(k, m.v.MapIndex(k))
+		}
+	}
+	for _, e := range strings.Split(value, ",") {
+		kv := strings.SplitN(e, "=", 2)
+		v := reflect.New(m.v.Type().Elem()).Elem()
+		if len(kv) == 2 {
+			if err := setScalar(v, kv[1]); err != nil {
+				return err
+			}
+		}
+		k := reflect.New(m.v.Type().Key()).Elem()
+		k.SetString(kv[0])
+		entries.SetMapIndex(k, v)
+	}
+	m.v.Set(entries)
+	m.added = true
+	return nil
+}
+
+func (m *mapValue) reset() {
+	m.added = false
+}